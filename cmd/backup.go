@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -15,18 +16,89 @@ import (
 	"github.com/briandowns/spinner"
 )
 
-type backupCommand struct{}
+type backupCommand struct {
+	dryRun  bool
+	json    bool
+	include []string
+	exclude []string
+	force   bool
+	root    string
+	yes     bool
+}
 
 func newBackupCommand() *cobra.Command {
 	bc := &backupCommand{}
 
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:              "backup",
 		Short:            "Backup env file(s) to your vault",
 		Aliases:          []string{"bk", "backup"},
 		PersistentPreRun: bc.preRun,
 		Run:              bc.run,
 	}
+
+	cmd.Flags().BoolVar(&bc.dryRun, "dry-run", false, "Print what would be backed up without writing to the vault")
+	cmd.Flags().BoolVar(&bc.json, "json", false, "Print the dry-run plan as JSON (requires --dry-run)")
+	cmd.Flags().StringSliceVar(&bc.include, "include", nil, "Glob pattern(s) of files to back up, replacing `include` from the config")
+	cmd.Flags().StringSliceVar(&bc.exclude, "exclude", nil, "Glob pattern(s) of files to skip, replacing `exclude` from the config")
+	cmd.Flags().BoolVar(&bc.force, "force", false, "Create a backup even when nothing changed since the latest one")
+	cmd.Flags().StringVar(&bc.root, "root", "", "Directory to back up instead of the detected project root")
+	cmd.Flags().BoolVarP(&bc.yes, "yes", "y", false, "Do not ask to confirm the project root")
+
+	cmd.AddCommand(newBackupMigrateCommand())
+	cmd.AddCommand(newBackupPruneCommand())
+
+	return cmd
+}
+
+type backupMigrateCommand struct {
+	dryRun bool
+}
+
+func newBackupMigrateCommand() *cobra.Command {
+	mc := &backupMigrateCommand{}
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move old <project>-<timestamp> backups from the vault root into the backups folder",
+		Args:  cobra.NoArgs,
+		Run:   mc.run,
+	}
+
+	cmd.Flags().BoolVar(&mc.dryRun, "dry-run", false, "Print the folders that would be moved without moving them")
+
+	return cmd
+}
+
+func (mc *backupMigrateCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting backup migrate command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	if mc.dryRun {
+		migrations, err := core.PlanBackupMigration(vaultDir)
+		if err != nil {
+			logrus.Errorf("Failed to plan backup migration: %v", err)
+			os.Exit(1)
+		}
+		core.PrintBackupMigration(os.Stdout, migrations, vaultDir, true)
+		return
+	}
+
+	migrated, err := core.MigrateBackups(vaultDir)
+	if len(migrated) > 0 || err == nil {
+		core.PrintBackupMigration(os.Stdout, migrated, vaultDir, false)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to migrate backups: %v", err)
+		os.Exit(1)
+	}
 }
 
 func (bc *backupCommand) preRun(cmd *cobra.Command, args []string) {
@@ -63,30 +135,203 @@ func (bc *backupCommand) run(cmd *cobra.Command, args []string) {
 	if !ok {
 		logrus.Error("Vault directory not found in context")
 		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
 	}
 	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
 
-	// Confirm that the current working directory is valid
-	if err := core.ConfirmCwd(); err != nil {
-		logrus.Errorf("Failed to confirm current working directory: %v", err)
+	if bc.json && !bc.dryRun {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("--json can only be used with --dry-run"))
 		os.Exit(1)
 	}
-	logrus.Debug("Current working directory confirmed")
+
+	root := backupRoot(bc.root)
+	if !bc.json {
+		core.PrintProjectRoot(os.Stdout, root)
+	}
+
+	opts := core.BackupOptions{
+		VaultDir:  vaultDir,
+		Root:      root.Dir,
+		Include:   viper.GetStringSlice("include"),
+		Exclude:   viper.GetStringSlice("exclude"),
+		Prune:     viper.GetStringSlice("prune"),
+		Gitignore: viper.GetBool("gitignore"),
+		Force:     bc.force,
+		Keys:      loadKeys(vaultDir),
+		Project:   backupProject(root.Dir),
+	}
+	if config, ok := projectConfigIn(root.Dir); ok && len(config.Files) > 0 {
+		opts.Include = config.Patterns()
+	}
+	if cmd.Flags().Changed("include") {
+		opts.Include = bc.include
+	}
+	if cmd.Flags().Changed("exclude") {
+		opts.Exclude = bc.exclude
+	}
+	logrus.Debugf("Backup patterns: include: %v, exclude: %v, prune: %v, gitignore: %t", opts.Include, opts.Exclude, opts.Prune, opts.Gitignore)
+
+	if bc.dryRun {
+		plan, err := core.PlanCopyToVault(opts)
+		if err != nil {
+			logrus.Errorf("Failed to plan backup: %v", err)
+			os.Exit(1)
+		}
+		if err := core.PrintPlan(os.Stdout, plan, vaultDir, bc.json); err != nil {
+			logrus.Errorf("Failed to print plan: %v", err)
+			os.Exit(1)
+		}
+		// Files that could not be planned would fail the real run as well.
+		if plan.Count(core.ActionError) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if !bc.yes {
+		if err := core.ConfirmRoot(cmd.Context(), root); err != nil {
+			logrus.Errorf("Failed to confirm project root: %v", err)
+			os.Exit(1)
+		}
+	}
 
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
 	s.Prefix = fmt.Sprintf("Backing up to %s", vaultDir)
 	s.Start()
 
 	logrus.Debugf("Starting backup action: copying env files to vault at %s", vaultDir)
-	if err := core.CopyEnvFilesToVault(vaultDir); err != nil {
-		logrus.Errorf("Failed to copy env files to vault: %v", err)
+	results, err := core.CopyEnvFilesToVault(cmd.Context(), opts)
+	s.Stop()
+	core.PrintResults(os.Stdout, results, vaultDir)
+	if err != nil {
+		// The failed backup was discarded, so old backups are kept as they are.
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(fmt.Sprintf("Failed to back up env files: %v", err)))
 		os.Exit(1)
 	}
 	logrus.Debug("Env files successfully backed up to vault")
 
-	s.Stop()
-
 	logrus.Debug("Spinner action completed")
+
+	policy := configRetentionPolicy()
+	if policy.IsZero() {
+		return
+	}
+
+	project := opts.Project
+	decisions, err := core.PlanBackupPrune(vaultDir, project, policy)
+	if err != nil {
+		logrus.Errorf("Failed to plan backup pruning: %v", err)
+		os.Exit(1)
+	}
+	if err := core.PruneBackups(vaultDir, decisions); err != nil {
+		logrus.Errorf("Failed to prune backups: %v", err)
+		os.Exit(1)
+	}
+	core.PrintPrunedBackups(os.Stdout, decisions, vaultDir)
+	logrus.Debugf("Pruned backups of %s with policy %+v", project, policy)
+}
+
+// backupRoot returns the directory given with --root, or the detected project root. It exits with a non-zero
+// code when the directory given does not exist.
+func backupRoot(dir string) core.ProjectRoot {
+	if dir == "" {
+		return projectRoot()
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(dir); err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(fmt.Sprintf("Invalid --root: %v", err)))
+		os.Exit(1)
+	}
+	return core.ProjectRoot{Dir: dir, Source: core.RootFlag}
+}
+
+// configRetentionPolicy reads the retention policy from the config.
+func configRetentionPolicy() core.RetentionPolicy {
+	return core.RetentionPolicy{
+		KeepLast:   viper.GetInt("keep_last"),
+		KeepDaily:  viper.GetInt("keep_daily"),
+		KeepWeekly: viper.GetInt("keep_weekly"),
+	}
+}
+
+type backupPruneCommand struct {
+	dryRun     bool
+	keepLast   int
+	keepDaily  int
+	keepWeekly int
+}
+
+func newBackupPruneCommand() *cobra.Command {
+	pc := &backupPruneCommand{}
+
+	cmd := &cobra.Command{
+		Use:   "prune [project]",
+		Short: "Remove old backups according to the retention policy",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   pc.run,
+	}
+
+	cmd.Flags().BoolVar(&pc.dryRun, "dry-run", false, "Print the backups that would be removed without removing them")
+	cmd.Flags().IntVar(&pc.keepLast, "keep-last", 0, "Keep the last n backups, replacing `keep_last` from the config")
+	cmd.Flags().IntVar(&pc.keepDaily, "keep-daily", 0, "Keep the last backup of the last n days, replacing `keep_daily` from the config")
+	cmd.Flags().IntVar(&pc.keepWeekly, "keep-weekly", 0, "Keep the last backup of the last n weeks, replacing `keep_weekly` from the config")
+
+	return cmd
+}
+
+func (pc *backupPruneCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting backup prune command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	policy := configRetentionPolicy()
+	if cmd.Flags().Changed("keep-last") {
+		policy.KeepLast = pc.keepLast
+	}
+	if cmd.Flags().Changed("keep-daily") {
+		policy.KeepDaily = pc.keepDaily
+	}
+	if cmd.Flags().Changed("keep-weekly") {
+		policy.KeepWeekly = pc.keepWeekly
+	}
+	logrus.Debugf("Using retention policy: %+v", policy)
+
+	if policy.IsZero() {
+		fmt.Printf("%s %s\n", utils.WarningIcon(), utils.WhiteText("No retention policy set, configure keep_last, keep_daily or keep_weekly first"))
+		os.Exit(1)
+	}
+
+	project := ""
+	if len(args) > 0 {
+		project = args[0]
+	}
+
+	decisions, err := core.PlanBackupPrune(vaultDir, project, policy)
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+
+	if !pc.dryRun {
+		if err := core.PruneBackups(vaultDir, decisions); err != nil {
+			logrus.Errorf("Failed to prune backups: %v", err)
+			os.Exit(1)
+		}
+	}
+	core.PrintPrunePlan(os.Stdout, decisions, vaultDir, pc.dryRun)
 }
 
 func init() {
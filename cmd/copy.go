@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -12,18 +14,37 @@ import (
 	"github.com/y3owk1n/cpenv/utils"
 )
 
-type copyCommand struct{}
+type copyCommand struct {
+	overwrite string
+	prefer    string
+	yes       bool
+	dryRun    bool
+	json      bool
+	all       bool
+	profile   string
+}
 
 func newCopyCommand() *cobra.Command {
 	cc := &copyCommand{}
 
-	return &cobra.Command{
-		Use:              "copy",
+	cmd := &cobra.Command{
+		Use:              "copy [project]",
 		Short:            "Copy env file(s) to your current project",
 		Aliases:          []string{"cp", "copy"},
+		Args:             cobra.MaximumNArgs(1),
 		PersistentPreRun: cc.preRun,
 		Run:              cc.run,
 	}
+
+	cmd.Flags().StringVar(&cc.overwrite, "overwrite", string(core.OverwritePrompt), "What to do with existing files: always, never, merge or prompt")
+	cmd.Flags().StringVar(&cc.prefer, "prefer", string(core.PreferVault), "Which value wins for keys on both sides when merging: vault or local")
+	cmd.Flags().BoolVarP(&cc.yes, "yes", "y", false, "Do not prompt; overwrite existing files unless --overwrite is set")
+	cmd.Flags().BoolVar(&cc.dryRun, "dry-run", false, "Print what would be copied without writing any file")
+	cmd.Flags().BoolVar(&cc.json, "json", false, "Print the dry-run plan as JSON (requires --dry-run)")
+	cmd.Flags().StringVar(&cc.profile, "profile", "", "Profile of the project to layer on its base files, e.g. staging for @staging")
+	cmd.Flags().BoolVar(&cc.all, "all", false, "Copy the whole project into the repository root instead of only the current subdirectory")
+
+	return cmd
 }
 
 func (cc *copyCommand) preRun(cmd *cobra.Command, args []string) {
@@ -60,26 +81,95 @@ func (cc *copyCommand) run(cmd *cobra.Command, args []string) {
 	if !ok {
 		logrus.Error("Vault directory not found in context")
 		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
 	}
 	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
 
-	directories, err := core.GetProjectsList(vaultDir)
+	if cc.json && !cc.dryRun {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("--json can only be used with --dry-run"))
+		os.Exit(1)
+	}
+
+	overwrite, err := core.ParseOverwriteMode(cc.overwrite)
 	if err != nil {
-		logrus.Debugf("Failed to get project lists: %v", err)
-		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("No projects found in the vault"))
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
 		os.Exit(1)
 	}
-	logrus.WithField("directories", directories).Debug("Retrieved project list")
+	if cc.yes && !cmd.Flags().Changed("overwrite") {
+		overwrite = core.OverwriteAlways
+	}
+	logrus.Debugf("Using overwrite mode: %s", overwrite)
 
-	directory, err := core.SelectProject(directories)
+	prefer, err := core.ParseMergePreference(cc.prefer)
 	if err != nil {
-		logrus.Errorf("Failed to select project: %v", err)
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
 		os.Exit(1)
 	}
+
+	directory := resolveProject(vaultDir, args)
 	logrus.Debugf("Selected project directory: %s", directory)
 
-	if err := core.CopyEnvFilesToProject(directory, "", vaultDir); err != nil {
-		logrus.Errorf("Failed to copy env files to project: %v", err)
+	profile := strings.TrimPrefix(cc.profile, core.ProfilePrefix)
+	if !cmd.Flags().Changed("profile") && len(args) == 0 && !cc.yes {
+		profile = selectProfile(vaultDir, directory)
+	}
+	if profile != "" && !cc.json {
+		fmt.Printf("%s %s %s\n", utils.InfoIcon(), utils.WhiteText("Using profile"), utils.CyanText(profile))
+	}
+
+	root := projectRoot().Dir
+	currentPath := ""
+	if !cc.all {
+		currentPath = subdirectory(root)
+	}
+	if currentPath != "" && !cc.json {
+		fmt.Printf("%s %s %s %s\n", utils.InfoIcon(), utils.WhiteText("Copying"), utils.CyanText(filepath.ToSlash(currentPath)), utils.WhiteText("only, use --all to copy the whole project"))
+	}
+	logrus.Debugf("Copying into root %s, current path: %s", root, currentPath)
+
+	opts := core.CopyOptions{
+		Project:     directory,
+		CurrentPath: currentPath,
+		Root:        root,
+		VaultDir:    vaultDir,
+		Overwrite:   overwrite,
+		Prefer:      prefer,
+		Keys:        loadKeys(vaultDir),
+		FileMode:    fileMode(),
+		Files:       managedFiles(cmd, cc.yes),
+		Profile:     profile,
+	}
+	command := "copy " + directory
+	if profile != "" {
+		command += " --profile " + profile
+	}
+	opts.Journal = core.NewJournal(vaultDir, opts.Keys, command)
+
+	if cc.dryRun {
+		plan, err := core.PlanCopyToProject(opts)
+		if err != nil {
+			logrus.Errorf("Failed to plan copy: %v", err)
+			os.Exit(1)
+		}
+		if err := core.PrintPlan(os.Stdout, plan, vaultDir, cc.json); err != nil {
+			logrus.Errorf("Failed to print plan: %v", err)
+			os.Exit(1)
+		}
+		// Files that could not be planned would fail the real run as well.
+		if plan.Count(core.ActionError) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	results, err := core.CopyEnvFilesToProject(cmd.Context(), opts)
+	if err == nil && len(results.Files) == 0 {
+		fmt.Printf("%s %s\n", utils.WarningIcon(), utils.WhiteText("No env files found to copy."))
+	}
+	core.PrintResults(os.Stdout, results, vaultDir)
+	printUndoHint(opts.Journal)
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(fmt.Sprintf("Failed to copy env files to project: %v", err)))
 		os.Exit(1)
 	}
 	logrus.WithFields(logrus.Fields{
@@ -88,6 +178,26 @@ func (cc *copyCommand) run(cmd *cobra.Command, args []string) {
 	}).Debug("Successfully copied env files to project")
 }
 
+// selectProfile asks which profile to layer on the base files of the project, as a second step after picking
+// the project. It returns an empty name when the project has no profiles.
+func selectProfile(vaultDir, project string) string {
+	profiles, err := core.ListProfiles(vaultDir, project)
+	if err != nil {
+		logrus.Errorf("Failed to list profiles: %v", err)
+		os.Exit(1)
+	}
+	if len(profiles) == 0 {
+		return ""
+	}
+
+	profile, err := core.SelectProfile(profiles)
+	if err != nil {
+		logrus.Errorf("Failed to select profile: %v", err)
+		os.Exit(1)
+	}
+	return profile
+}
+
 func init() {
 	rootCmd.AddCommand(newCopyCommand())
 }
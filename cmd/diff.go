@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/y3owk1n/cpenv/core"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+type diffCommand struct {
+	reveal  bool
+	all     bool
+	profile string
+}
+
+func newDiffCommand() *cobra.Command {
+	dc := &diffCommand{}
+
+	cmd := &cobra.Command{
+		Use:              "diff [project]",
+		Short:            "Show key differences between a vault project and your current project",
+		Aliases:          []string{"df", "diff"},
+		Args:             cobra.MaximumNArgs(1),
+		PersistentPreRun: dc.preRun,
+		Run:              dc.run,
+	}
+
+	cmd.Flags().BoolVar(&dc.reveal, "reveal", false, "Show values instead of masking them")
+	cmd.Flags().StringVar(&dc.profile, "profile", "", "Profile of the project to layer on its base files, e.g. staging for @staging")
+	cmd.Flags().BoolVar(&dc.all, "all", false, "Compare the whole project with the repository root instead of only the current subdirectory")
+
+	return cmd
+}
+
+func (dc *diffCommand) preRun(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting diff command preRun")
+
+	configPath := viper.ConfigFileUsed()
+	if configPath == "" {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("Please run `cpenv config init` first"))
+		os.Exit(0)
+	}
+	logrus.Debugf("Using config file: %s", configPath)
+
+	vaultDir := viper.GetString("vault_dir")
+	logrus.Debugf("Vault directory from config: %s", vaultDir)
+
+	vaultDirFull, err := core.GetFullVaultDir(vaultDir)
+	if err != nil {
+		logrus.Errorf("Failed to get env file directory: %v", err)
+		os.Exit(1)
+	}
+	logrus.Debugf("Resolved full vault directory: %s", vaultDirFull)
+
+	ctx := cmd.Context()
+	ctx = context.WithValue(ctx, ConfigKey, configPath)
+	ctx = context.WithValue(ctx, VaultKey, vaultDirFull)
+	cmd.SetContext(ctx)
+	logrus.Debugf("Context set with ConfigKey=%s and VaultKey=%s", configPath, vaultDirFull)
+}
+
+func (dc *diffCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting diff command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	project := resolveProject(vaultDir, args)
+	logrus.Debugf("Selected project directory: %s", project)
+
+	profile := strings.TrimPrefix(dc.profile, core.ProfilePrefix)
+	if !cmd.Flags().Changed("profile") && len(args) == 0 {
+		profile = selectProfile(vaultDir, project)
+	}
+	if profile != "" {
+		fmt.Printf("%s %s %s\n", utils.InfoIcon(), utils.WhiteText("Using profile"), utils.CyanText(profile))
+	}
+
+	root := projectRoot().Dir
+	currentPath := ""
+	if !dc.all {
+		currentPath = subdirectory(root)
+	}
+	if currentPath != "" {
+		fmt.Printf("%s %s %s %s\n", utils.InfoIcon(), utils.WhiteText("Comparing"), utils.CyanText(filepath.ToSlash(currentPath)), utils.WhiteText("only, use --all to compare the whole project"))
+	}
+	logrus.Debugf("Comparing with root %s, current path: %s", root, currentPath)
+
+	diffs, err := core.DiffProject(core.CopyOptions{
+		Project:     project,
+		CurrentPath: currentPath,
+		Root:        root,
+		VaultDir:    vaultDir,
+		Keys:        loadKeys(vaultDir),
+		Files:       managedFiles(cmd, false),
+		Profile:     profile,
+	})
+	if err != nil {
+		logrus.Errorf("Failed to diff project: %v", err)
+		os.Exit(1)
+	}
+
+	core.PrintDiff(os.Stdout, diffs, vaultDir, dc.reveal)
+}
+
+func init() {
+	rootCmd.AddCommand(newDiffCommand())
+}
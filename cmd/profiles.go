@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/y3owk1n/cpenv/core"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+type profilesCommand struct{}
+
+func newProfilesCommand() *cobra.Command {
+	pc := &profilesCommand{}
+
+	cmd := &cobra.Command{
+		Use:              "profiles [project]",
+		Short:            "List the profiles of a vault project",
+		Args:             cobra.MaximumNArgs(1),
+		PersistentPreRun: pc.preRun,
+		Run:              pc.run,
+	}
+
+	return cmd
+}
+
+func (pc *profilesCommand) preRun(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting profiles command preRun")
+
+	configPath := viper.ConfigFileUsed()
+	if configPath == "" {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("Please run `cpenv config init` first"))
+		os.Exit(0)
+	}
+	logrus.Debugf("Using config file: %s", configPath)
+
+	vaultDir := viper.GetString("vault_dir")
+	logrus.Debugf("Vault directory from config: %s", vaultDir)
+
+	vaultDirFull, err := core.GetFullVaultDir(vaultDir)
+	if err != nil {
+		logrus.Errorf("Failed to get env file directory: %v", err)
+		os.Exit(1)
+	}
+	logrus.Debugf("Resolved full vault directory: %s", vaultDirFull)
+
+	ctx := cmd.Context()
+	ctx = context.WithValue(ctx, ConfigKey, configPath)
+	ctx = context.WithValue(ctx, VaultKey, vaultDirFull)
+	cmd.SetContext(ctx)
+	logrus.Debugf("Context set with ConfigKey=%s and VaultKey=%s", configPath, vaultDirFull)
+}
+
+func (pc *profilesCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting profiles command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	project := resolveProject(vaultDir, args)
+	logrus.Debugf("Selected project directory: %s", project)
+
+	profiles, err := core.ListProfiles(vaultDir, project)
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	core.PrintProfiles(os.Stdout, project, profiles)
+}
+
+func init() {
+	rootCmd.AddCommand(newProfilesCommand())
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/y3owk1n/cpenv/core"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// resolveProject returns the project named in args, or asks the user to pick one from the vault.
+// It exits with a non-zero code when the project cannot be resolved. Its messages go to stderr, so they do not
+// end up in a plan printed with --json.
+func resolveProject(vaultDir string, args []string) string {
+	if len(args) == 0 {
+		if config, ok := projectConfig(); ok && config.Project != "" {
+			fmt.Fprintf(os.Stderr, "%s %s %s %s\n", utils.InfoIcon(), utils.WhiteText("Using project"), utils.CyanText(config.Project), utils.WhiteText("from "+config.Path))
+			args = []string{config.Project}
+		}
+	}
+
+	if len(args) > 0 {
+		project := args[0]
+
+		exists, err := core.ProjectExists(vaultDir, project)
+		if err != nil {
+			logrus.Errorf("Failed to check project: %v", err)
+			os.Exit(1)
+		}
+		if !exists {
+			fmt.Fprintf(os.Stderr, "%s %s %s\n", utils.ErrorIcon(), utils.WhiteText("Project not found in the vault:"), utils.CyanText(project))
+			os.Exit(1)
+		}
+		return project
+	}
+
+	directories, err := core.GetProjectsList(vaultDir)
+	if err != nil {
+		logrus.Debugf("Failed to get project lists: %v", err)
+		fmt.Fprintf(os.Stderr, "%s %s\n", utils.ErrorIcon(), utils.WhiteText("No projects found in the vault"))
+		os.Exit(1)
+	}
+	logrus.WithField("directories", directories).Debug("Retrieved project list")
+
+	detected, _, err := core.DetectProject(vaultDir, utils.GetCurrentWorkingDirectory())
+	if err != nil {
+		logrus.Debugf("Failed to detect project from git: %v", err)
+	}
+
+	project, err := core.SelectProject(directories, detected)
+	if err != nil {
+		logrus.Errorf("Failed to select project: %v", err)
+		os.Exit(1)
+	}
+	return project
+}
+
+// identityFile returns the configured identity file as an absolute path.
+func identityFile() string {
+	identityFile, err := core.GetFullIdentityFile(viper.GetString("identity_file"))
+	if err != nil {
+		logrus.Errorf("Failed to resolve identity file: %v", err)
+		os.Exit(1)
+	}
+	return identityFile
+}
+
+// fileMode returns the configured mode of env files. It exits with a non-zero code when it is invalid.
+func fileMode() fs.FileMode {
+	mode, err := core.ParseFileMode(viper.Get("file_mode"))
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(fmt.Sprintf("Invalid file_mode in config: %v", err)))
+		os.Exit(1)
+	}
+	return mode
+}
+
+// printUndoHint tells the user how to revert a run that changed files.
+func printUndoHint(journal *core.Journal) {
+	if journal.Len() > 0 {
+		fmt.Printf("%s %s\n", utils.InfoIcon(), utils.WhiteText("Run `cpenv undo` to revert these changes."))
+	}
+}
+
+// loadKeys loads the keys to read and write the vault. It exits with a non-zero code when an encrypted
+// vault cannot be opened.
+func loadKeys(vaultDir string) *core.Keys {
+	keys, err := core.LoadKeys(vaultDir, identityFile())
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	return keys
+}
+
+// projectConfig returns the .cpenv.yaml of the repository of the working directory. It exits with a non-zero
+// code when the config is invalid.
+func projectConfig() (core.ProjectConfig, bool) {
+	return projectConfigIn(utils.GetCurrentWorkingDirectory())
+}
+
+// projectConfigIn returns the .cpenv.yaml of the repository of dir, see projectConfig.
+func projectConfigIn(dir string) (core.ProjectConfig, bool) {
+	config, ok, err := core.FindProjectConfig(dir)
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	return config, ok
+}
+
+// projectRoot returns the root of the project the working directory is in, using `root_markers` from the
+// config. It exits with a non-zero code when the root cannot be detected.
+func projectRoot() core.ProjectRoot {
+	root, err := core.FindProjectRoot(utils.GetCurrentWorkingDirectory(), viper.GetStringSlice("root_markers"))
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	logrus.Debugf("Detected project root %s by %s", root.Dir, root.Reason())
+	return root
+}
+
+// subdirectory returns the working directory relative to root, or "" when it is root itself or outside of it.
+func subdirectory(root string) string {
+	relativePath, err := filepath.Rel(root, utils.GetCurrentWorkingDirectory())
+	if err != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+		return ""
+	}
+	return relativePath
+}
+
+// backupProject returns the project the backups of root are named after: the project of .cpenv.yaml, the name
+// of the git repository, or the name of root.
+func backupProject(root string) string {
+	if config, ok := projectConfigIn(root); ok && config.Project != "" {
+		return config.Project
+	}
+
+	repo, ok, err := core.DetectRepository(root)
+	if err != nil {
+		logrus.Debugf("Failed to detect git repository: %v", err)
+	}
+	if ok && repo.Name() != "" {
+		return repo.Name()
+	}
+	return filepath.Base(root)
+}
+
+// managedFiles returns the files listed in .cpenv.yaml for copy, restore and diff. Their overwrite policy is left
+// out when the overwrite mode is given on the command line.
+func managedFiles(cmd *cobra.Command, yes bool) []core.ProjectFile {
+	config, ok := projectConfig()
+	if !ok {
+		return nil
+	}
+	if yes || cmd.Flags().Changed("overwrite") {
+		return config.WithoutOverwrite()
+	}
+	return config.Files
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/y3owk1n/cpenv/core"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+type restoreCommand struct {
+	latest    bool
+	list      bool
+	all       bool
+	overwrite string
+	prefer    string
+	yes       bool
+	dryRun    bool
+	json      bool
+}
+
+func newRestoreCommand() *cobra.Command {
+	rc := &restoreCommand{}
+
+	cmd := &cobra.Command{
+		Use:              "restore [project]",
+		Short:            "Restore env file(s) from a backup of your current project",
+		Aliases:          []string{"rs", "restore"},
+		Args:             cobra.MaximumNArgs(1),
+		PersistentPreRun: rc.preRun,
+		Run:              rc.run,
+	}
+
+	cmd.Flags().BoolVar(&rc.latest, "latest", false, "Restore the most recent backup without prompting for one")
+	cmd.Flags().BoolVar(&rc.list, "list", false, "List backups and the files they contain instead of restoring")
+	cmd.Flags().BoolVar(&rc.all, "all", false, "Include backups of every project (with --list or when choosing)")
+	cmd.Flags().StringVar(&rc.overwrite, "overwrite", string(core.OverwritePrompt), "What to do with existing files: always, never, merge or prompt")
+	cmd.Flags().StringVar(&rc.prefer, "prefer", string(core.PreferVault), "Which value wins for keys on both sides when merging: vault or local")
+	cmd.Flags().BoolVarP(&rc.yes, "yes", "y", false, "Do not prompt; restore the latest backup and overwrite existing files unless --overwrite is set")
+	cmd.Flags().BoolVar(&rc.dryRun, "dry-run", false, "Print what would be restored without writing any file")
+	cmd.Flags().BoolVar(&rc.json, "json", false, "Print the dry-run plan as JSON (requires --dry-run)")
+
+	return cmd
+}
+
+func (rc *restoreCommand) preRun(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting restore command preRun")
+
+	configPath := viper.ConfigFileUsed()
+	if configPath == "" {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("Please run `cpenv config init` first"))
+		os.Exit(0)
+	}
+	logrus.Debugf("Using config file: %s", configPath)
+
+	vaultDir := viper.GetString("vault_dir")
+	logrus.Debugf("Vault directory from config: %s", vaultDir)
+
+	vaultDirFull, err := core.GetFullVaultDir(vaultDir)
+	if err != nil {
+		logrus.Errorf("Failed to get env file directory: %v", err)
+		os.Exit(1)
+	}
+	logrus.Debugf("Resolved full vault directory: %s", vaultDirFull)
+
+	ctx := cmd.Context()
+	ctx = context.WithValue(ctx, ConfigKey, configPath)
+	ctx = context.WithValue(ctx, VaultKey, vaultDirFull)
+	cmd.SetContext(ctx)
+	logrus.Debugf("Context set with ConfigKey=%s and VaultKey=%s", configPath, vaultDirFull)
+}
+
+func (rc *restoreCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting restore command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	if rc.json && !rc.dryRun {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("--json can only be used with --dry-run"))
+		os.Exit(1)
+	}
+
+	overwrite, err := core.ParseOverwriteMode(rc.overwrite)
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	if rc.yes && !cmd.Flags().Changed("overwrite") {
+		overwrite = core.OverwriteAlways
+	}
+
+	prefer, err := core.ParseMergePreference(rc.prefer)
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+
+	backups, err := core.ListBackups(vaultDir)
+	if err != nil {
+		logrus.Errorf("Failed to list backups: %v", err)
+		os.Exit(1)
+	}
+
+	root := projectRoot().Dir
+	project := backupProject(root)
+	if len(args) > 0 {
+		project = args[0]
+	}
+	if !rc.all {
+		backups = core.FilterBackups(backups, project)
+	}
+	logrus.Debugf("Backups for project %s: %d", project, len(backups))
+
+	if rc.list {
+		core.PrintBackups(os.Stdout, backups)
+		return
+	}
+
+	if len(backups) == 0 {
+		fmt.Printf("%s %s %s\n", utils.ErrorIcon(), utils.WhiteText("No backups found for"), utils.CyanText(project))
+		if legacy, err := core.PlanBackupMigration(vaultDir); err == nil && len(legacy) > 0 {
+			fmt.Printf("%s %s\n", utils.InfoIcon(), utils.WhiteText("Older backups were found in the vault root, run `cpenv backup migrate` to restore them"))
+		}
+		os.Exit(1)
+	}
+
+	// --yes never prompts, so it restores the latest backup like --latest.
+	backup := backups[0]
+	if rc.latest || rc.yes {
+		if rc.all {
+			flag := "--latest"
+			if !rc.latest {
+				flag = "--yes"
+			}
+			fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(flag+" restores the latest backup and cannot be used with --all"))
+			os.Exit(1)
+		}
+	} else if backup, err = core.SelectBackup(backups); err != nil {
+		logrus.Errorf("Failed to select backup: %v", err)
+		os.Exit(1)
+	}
+	logrus.Debugf("Restoring backup: %s", backup.Name)
+
+	opts := core.CopyOptions{
+		Project:   backup.Name,
+		Root:      root,
+		VaultDir:  vaultDir,
+		Overwrite: overwrite,
+		Prefer:    prefer,
+		Keys:      loadKeys(vaultDir),
+		FileMode:  fileMode(),
+		Files:     managedFiles(cmd, rc.yes),
+	}
+	opts.Journal = core.NewJournal(vaultDir, opts.Keys, "restore "+backup.Name)
+
+	if rc.dryRun {
+		plan, err := core.PlanCopyToProject(opts)
+		if err != nil {
+			logrus.Errorf("Failed to plan restore: %v", err)
+			os.Exit(1)
+		}
+		if err := core.PrintPlan(os.Stdout, plan, vaultDir, rc.json); err != nil {
+			logrus.Errorf("Failed to print plan: %v", err)
+			os.Exit(1)
+		}
+		// Files that could not be planned would fail the real run as well.
+		if plan.Count(core.ActionError) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	results, err := core.CopyEnvFilesToProject(cmd.Context(), opts)
+	core.PrintResults(os.Stdout, results, vaultDir)
+	printUndoHint(opts.Journal)
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(fmt.Sprintf("Failed to restore backup: %v", err)))
+		os.Exit(1)
+	}
+	logrus.Debugf("Successfully restored backup %s", backup.Name)
+}
+
+func init() {
+	rootCmd.AddCommand(newRestoreCommand())
+}
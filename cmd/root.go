@@ -30,6 +30,9 @@ func Execute() {
 	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		os.Exit(1)
 	}
+	if ctx.Err() != nil {
+		os.Exit(1)
+	}
 }
 
 func initConfig() {
@@ -45,7 +48,11 @@ func initConfig() {
 		<-sigCh
 		fmt.Println()
 		logrus.Debug("Interrupt received, canceling operations...")
+		// Commands stop after the file they are writing; writes are atomic, so nothing is left half-written.
 		cancel()
+
+		<-sigCh
+		logrus.Debug("Second interrupt received, exiting")
 		os.Exit(1)
 	}()
 
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/y3owk1n/cpenv/core"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+type undoCommand struct {
+	list   bool
+	force  bool
+	dryRun bool
+}
+
+func newUndoCommand() *cobra.Command {
+	uc := &undoCommand{}
+
+	cmd := &cobra.Command{
+		Use:              "undo [run]",
+		Short:            "Revert the files changed by the last copy or restore",
+		Args:             cobra.MaximumNArgs(1),
+		PersistentPreRun: uc.preRun,
+		Run:              uc.run,
+	}
+
+	cmd.Flags().BoolVar(&uc.list, "list", false, "List the runs that can be undone")
+	cmd.Flags().BoolVar(&uc.force, "force", false, "Also revert files that were edited after the run")
+	cmd.Flags().BoolVar(&uc.dryRun, "dry-run", false, "Print what would be reverted without changing any file")
+
+	return cmd
+}
+
+func (uc *undoCommand) preRun(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting undo command preRun")
+
+	configPath := viper.ConfigFileUsed()
+	if configPath == "" {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("Please run `cpenv config init` first"))
+		os.Exit(0)
+	}
+	logrus.Debugf("Using config file: %s", configPath)
+
+	vaultDir := viper.GetString("vault_dir")
+	logrus.Debugf("Vault directory from config: %s", vaultDir)
+
+	vaultDirFull, err := core.GetFullVaultDir(vaultDir)
+	if err != nil {
+		logrus.Errorf("Failed to get vault directory: %v", err)
+		os.Exit(1)
+	}
+	logrus.Debugf("Resolved full vault directory: %s", vaultDirFull)
+
+	ctx := cmd.Context()
+	ctx = context.WithValue(ctx, ConfigKey, configPath)
+	ctx = context.WithValue(ctx, VaultKey, vaultDirFull)
+	cmd.SetContext(ctx)
+	logrus.Debugf("Context set with ConfigKey=%s and VaultKey=%s", configPath, vaultDirFull)
+}
+
+func (uc *undoCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting undo command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	runs, err := core.ListJournalRuns(vaultDir)
+	if err != nil {
+		logrus.Errorf("Failed to read journal: %v", err)
+		os.Exit(1)
+	}
+
+	if uc.list || len(runs) == 0 {
+		core.PrintJournalRuns(os.Stdout, runs)
+		return
+	}
+
+	run := runs[0]
+	if len(args) > 0 {
+		found := false
+		for _, r := range runs {
+			if r.ID == args[0] {
+				run, found = r, true
+				break
+			}
+		}
+		if !found {
+			fmt.Printf("%s %s %s\n", utils.ErrorIcon(), utils.WhiteText("Run not found in the journal:"), utils.CyanText(args[0]))
+			os.Exit(1)
+		}
+	}
+	logrus.Debugf("Undoing run: %s", run.ID)
+
+	steps, err := core.PlanUndo(run, uc.force)
+	if err != nil {
+		logrus.Errorf("Failed to plan undo: %v", err)
+		os.Exit(1)
+	}
+	core.PrintUndo(os.Stdout, run, steps, vaultDir, uc.dryRun)
+	if uc.dryRun {
+		return
+	}
+
+	if err := core.UndoRun(vaultDir, run, steps, loadKeys(vaultDir)); err != nil {
+		logrus.Errorf("Failed to undo run: %v", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s\n", utils.SuccessIcon(), utils.WhiteText("Undo complete."))
+}
+
+func init() {
+	rootCmd.AddCommand(newUndoCommand())
+}
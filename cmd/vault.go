@@ -12,18 +12,453 @@ import (
 	"github.com/y3owk1n/cpenv/utils"
 )
 
-type vaultCommand struct{}
+type vaultCommand struct {
+	print bool
+}
 
 func newVaultCmd() *cobra.Command {
 	vc := &vaultCommand{}
 
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:              "vault",
-		Short:            "Open vault in finder",
+		Short:            "Open vault in your file manager",
 		Aliases:          []string{"v", "vault"},
 		PersistentPreRun: vc.preRun,
 		Run:              vc.run,
 	}
+
+	cmd.Flags().BoolVar(&vc.print, "print", false, "Print the vault path instead of opening it, e.g. cd $(cpenv vault --print)")
+
+	cmd.AddCommand(newVaultLsCommand())
+	cmd.AddCommand(newVaultTreeCommand())
+	cmd.AddCommand(newVaultShowCommand())
+	cmd.AddCommand(newVaultDedupeCommand())
+	cmd.AddCommand(newVaultEncryptCommand())
+	cmd.AddCommand(newVaultDecryptCommand())
+	cmd.AddCommand(newVaultMembersCommand())
+	cmd.AddCommand(newVaultRekeyCommand())
+	cmd.AddCommand(newVaultFixPermsCommand())
+
+	return cmd
+}
+
+type vaultLsCommand struct{}
+
+func newVaultLsCommand() *cobra.Command {
+	lc := &vaultLsCommand{}
+
+	return &cobra.Command{
+		Use:     "ls",
+		Short:   "List the projects in the vault with their file count, size and last modification",
+		Aliases: []string{"list"},
+		Args:    cobra.NoArgs,
+		Run:     lc.run,
+	}
+}
+
+func (lc *vaultLsCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault ls command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	summaries, err := core.ListProjectSummaries(vaultDir)
+	if err != nil {
+		logrus.Errorf("Failed to list projects: %v", err)
+		os.Exit(1)
+	}
+	core.PrintProjectSummaries(os.Stdout, summaries)
+}
+
+type vaultTreeCommand struct{}
+
+func newVaultTreeCommand() *cobra.Command {
+	tc := &vaultTreeCommand{}
+
+	return &cobra.Command{
+		Use:   "tree [project]",
+		Short: "Show the files of a project as a tree",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   tc.run,
+	}
+}
+
+func (tc *vaultTreeCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault tree command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	project := resolveProject(vaultDir, args)
+	files, err := core.ListProjectFiles(vaultDir, project)
+	if err != nil {
+		logrus.Errorf("Failed to list project files: %v", err)
+		os.Exit(1)
+	}
+	core.PrintTree(os.Stdout, project, files)
+}
+
+type vaultShowCommand struct {
+	reveal bool
+}
+
+func newVaultShowCommand() *cobra.Command {
+	sc := &vaultShowCommand{}
+
+	cmd := &cobra.Command{
+		Use:   "show <project> <file>",
+		Short: "Print an env file of a project with its values masked",
+		Args:  cobra.ExactArgs(2),
+		Run:   sc.run,
+	}
+
+	cmd.Flags().BoolVar(&sc.reveal, "reveal", false, "Show values instead of masking them")
+
+	return cmd
+}
+
+func (sc *vaultShowCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault show command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	project := resolveProject(vaultDir, args[:1])
+	data, err := core.ReadProjectFile(vaultDir, project, args[1], loadKeys(vaultDir))
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	if err := core.PrintEnvFile(os.Stdout, data, sc.reveal); err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+}
+
+type vaultDedupeCommand struct{}
+
+func newVaultDedupeCommand() *cobra.Command {
+	dc := &vaultDedupeCommand{}
+
+	return &cobra.Command{
+		Use:   "dedupe [project]",
+		Short: "Move plain project and backup files into the deduplicated object store",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   dc.run,
+	}
+}
+
+func (dc *vaultDedupeCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault dedupe command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	project := ""
+	if len(args) > 0 {
+		project = resolveProject(vaultDir, args)
+	}
+
+	results, err := core.DedupeVault(cmd.Context(), vaultDir, project, loadKeys(vaultDir))
+	for _, result := range results {
+		fmt.Printf("%s %s %s (%d file(s))\n", utils.SuccessIcon(), utils.WhiteText("Deduplicated"), utils.CyanText(result.Dir), result.Files)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to dedupe vault: %v", err)
+		os.Exit(1)
+	}
+	if len(results) == 0 {
+		fmt.Printf("%s %s\n", utils.SuccessIcon(), utils.WhiteText("Nothing to deduplicate."))
+	}
+}
+
+type vaultEncryptCommand struct{}
+
+func newVaultEncryptCommand() *cobra.Command {
+	ec := &vaultEncryptCommand{}
+
+	return &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt every file in the vault, generating an identity when needed",
+		Args:  cobra.NoArgs,
+		Run:   ec.run,
+	}
+}
+
+func (ec *vaultEncryptCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault encrypt command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	identityFile := identityFile()
+	keys, err := core.InitEncryption(vaultDir, identityFile)
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s %s\n", utils.InfoIcon(), utils.WhiteText("Using identity"), utils.CyanText(identityFile))
+
+	files, err := core.EncryptVault(cmd.Context(), vaultDir, keys)
+	if err != nil {
+		logrus.Errorf("Failed to encrypt vault: %v", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s (%d file(s))\n", utils.SuccessIcon(), utils.WhiteText("Encrypted vault"), files)
+}
+
+type vaultDecryptCommand struct{}
+
+func newVaultDecryptCommand() *cobra.Command {
+	dc := &vaultDecryptCommand{}
+
+	return &cobra.Command{
+		Use:   "decrypt",
+		Short: "Decrypt every file in the vault and stop encrypting new files",
+		Args:  cobra.NoArgs,
+		Run:   dc.run,
+	}
+}
+
+func (dc *vaultDecryptCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault decrypt command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	files, err := core.DecryptVault(cmd.Context(), vaultDir, loadKeys(vaultDir))
+	if err != nil {
+		logrus.Errorf("Failed to decrypt vault: %v", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s (%d file(s))\n", utils.SuccessIcon(), utils.WhiteText("Decrypted vault"), files)
+}
+
+type vaultMembersCommand struct{}
+
+func newVaultMembersCommand() *cobra.Command {
+	mc := &vaultMembersCommand{}
+
+	cmd := &cobra.Command{
+		Use:   "members",
+		Short: "List the members whose public keys the vault is encrypted to",
+		Args:  cobra.NoArgs,
+		Run:   mc.run,
+	}
+
+	cmd.AddCommand(newVaultMembersAddCommand())
+	cmd.AddCommand(newVaultMembersRemoveCommand())
+
+	return cmd
+}
+
+func (mc *vaultMembersCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault members command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	members, err := core.ListMembers(vaultDir)
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	core.PrintMembers(os.Stdout, members)
+}
+
+type vaultMembersAddCommand struct {
+	name string
+}
+
+func newVaultMembersAddCommand() *cobra.Command {
+	ac := &vaultMembersAddCommand{}
+
+	cmd := &cobra.Command{
+		Use:   "add [public-key]",
+		Short: "Add a public key to the vault, or your own when none is given",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   ac.run,
+	}
+
+	cmd.Flags().StringVar(&ac.name, "name", "", "Name of the member, written above the key in the recipients file")
+
+	return cmd
+}
+
+func (ac *vaultMembersAddCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault members add command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	member := core.Member{Name: ac.name}
+	if len(args) > 0 {
+		member.PublicKey = args[0]
+	} else {
+		publicKey, err := core.PublicKey(identityFile())
+		if err != nil {
+			fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+			os.Exit(1)
+		}
+		member.PublicKey = publicKey
+	}
+
+	if err := core.AddMember(vaultDir, member); err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s %s\n", utils.SuccessIcon(), utils.WhiteText("Added member"), utils.CyanText(member.PublicKey))
+	fmt.Printf("%s %s\n", utils.InfoIcon(), utils.WhiteText("Existing files stay unreadable for the new member until someone who can read the vault runs `cpenv vault rekey`."))
+}
+
+type vaultMembersRemoveCommand struct{}
+
+func newVaultMembersRemoveCommand() *cobra.Command {
+	rc := &vaultMembersRemoveCommand{}
+
+	return &cobra.Command{
+		Use:   "remove <name-or-public-key>",
+		Short: "Remove a member from the vault",
+		Args:  cobra.ExactArgs(1),
+		Run:   rc.run,
+	}
+}
+
+func (rc *vaultMembersRemoveCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault members remove command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	removed, err := core.RemoveMember(vaultDir, args[0])
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s %s\n", utils.SuccessIcon(), utils.WhiteText("Removed member"), utils.CyanText(removed.PublicKey))
+	fmt.Printf("%s %s\n", utils.InfoIcon(), utils.WhiteText("Run `cpenv vault rekey` so that the removed member can no longer decrypt the vault."))
+}
+
+type vaultRekeyCommand struct{}
+
+func newVaultRekeyCommand() *cobra.Command {
+	rc := &vaultRekeyCommand{}
+
+	return &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypt every file in the vault to the current members",
+		Args:  cobra.NoArgs,
+		Run:   rc.run,
+	}
+}
+
+func (rc *vaultRekeyCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault rekey command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	files, err := core.RekeyVault(cmd.Context(), vaultDir, loadKeys(vaultDir))
+	if err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s (%d file(s))\n", utils.SuccessIcon(), utils.WhiteText("Rekeyed vault"), files)
+}
+
+type vaultFixPermsCommand struct {
+	dryRun bool
+}
+
+func newVaultFixPermsCommand() *cobra.Command {
+	fc := &vaultFixPermsCommand{}
+
+	cmd := &cobra.Command{
+		Use:   "fix-perms",
+		Short: "Remove group and other permissions from the files and directories of the vault",
+		Args:  cobra.NoArgs,
+		Run:   fc.run,
+	}
+
+	cmd.Flags().BoolVar(&fc.dryRun, "dry-run", false, "Print which permissions would change without changing them")
+
+	return cmd
+}
+
+func (fc *vaultFixPermsCommand) run(cmd *cobra.Command, args []string) {
+	logrus.WithField("args", args).Debug("Starting vault fix-perms command run")
+
+	vaultDir, ok := cmd.Context().Value(VaultKey).(string)
+	if !ok {
+		logrus.Error("Vault directory not found in context")
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText("vault config not found in context"))
+		os.Exit(1)
+	}
+	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
+
+	fixes, err := core.PlanFixPermissions(vaultDir)
+	if err != nil {
+		logrus.Errorf("Failed to plan permission fixes: %v", err)
+		os.Exit(1)
+	}
+
+	if !fc.dryRun {
+		if err := core.FixPermissions(cmd.Context(), fixes); err != nil {
+			logrus.Errorf("Failed to fix permissions: %v", err)
+			os.Exit(1)
+		}
+	}
+	core.PrintPermissionFixes(os.Stdout, fixes, vaultDir, fc.dryRun)
 }
 
 func (vc *vaultCommand) preRun(cmd *cobra.Command, args []string) {
@@ -64,13 +499,18 @@ func (vc *vaultCommand) run(cmd *cobra.Command, args []string) {
 	}
 	logrus.Debugf("Retrieved vault directory from context: %s", vaultDir)
 
-	if err := utils.OpenInFinder(vaultDir); err != nil {
-		logrus.Errorf("Failed to open vault directory in finder: %v", err)
+	if vc.print {
+		fmt.Println(vaultDir)
+		return
+	}
+
+	if err := utils.OpenDirectory(vaultDir, viper.GetString("opener")); err != nil {
+		fmt.Printf("%s %s\n", utils.ErrorIcon(), utils.WhiteText(err.Error()))
 		os.Exit(1)
 	}
-	logrus.Debugf("Vault directory opened in finder successfully: %s", vaultDir)
+	logrus.Debugf("Vault directory opened successfully: %s", vaultDir)
 
-	fmt.Printf("%s %s\n", utils.SuccessIcon(), utils.WhiteText("Successfully opened vault in finder."))
+	fmt.Printf("%s %s\n", utils.SuccessIcon(), utils.WhiteText("Successfully opened vault."))
 }
 
 func init() {
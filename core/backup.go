@@ -0,0 +1,301 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// BackupsDirName is the vault directory holding backups as `<project>/<timestamp>`.
+const BackupsDirName = ".backups"
+
+// BackupsDir returns the directory backups are stored in for the given vault.
+func BackupsDir(vaultDir string) string {
+	return filepath.Join(vaultDir, BackupsDirName)
+}
+
+// Backup is a single snapshot written by CopyEnvFilesToVault.
+type Backup struct {
+	Project   string
+	Timestamp time.Time
+	// Name is the snapshot directory relative to the vault and can be used as CopyOptions.Project.
+	Name string
+	// Files are the backed up files relative to the snapshot directory.
+	Files []string
+}
+
+// ParseBackupName splits a legacy `<project>-<timestamp>` folder name from the vault root.
+// ok is false for folders that are not backups.
+func ParseBackupName(name string) (project string, timestamp time.Time, ok bool) {
+	suffixLength := len(utils.BackupTimestampLayout) + 1
+	if len(name) <= suffixLength || name[len(name)-suffixLength] != '-' {
+		return "", time.Time{}, false
+	}
+
+	timestamp, err := utils.ParseBackupTimestamp(name[len(name)-suffixLength+1:])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return name[:len(name)-suffixLength], timestamp, true
+}
+
+// parseSnapshotName parses the `<timestamp>` name of a snapshot, which has a `-<n>` suffix when it was
+// taken within the same second as an earlier backup of the project.
+func parseSnapshotName(name string) (time.Time, bool) {
+	timestamp := name
+	if len(name) > len(utils.BackupTimestampLayout) && name[len(utils.BackupTimestampLayout)] == '-' {
+		n, err := strconv.Atoi(name[len(utils.BackupTimestampLayout)+1:])
+		if err != nil || n < 2 {
+			return time.Time{}, false
+		}
+		timestamp = name[:len(utils.BackupTimestampLayout)]
+	}
+
+	parsed, err := utils.ParseBackupTimestamp(timestamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
+// ListBackups returns every backup in the vault, sorted by project and then newest first.
+func ListBackups(vaultDir string) ([]Backup, error) {
+	backupsDir := BackupsDir(vaultDir)
+	logrus.Debugf("Listing backups in: %s", backupsDir)
+
+	// A vault without backups has no backups directory, which is not an error.
+	if _, err := os.Stat(backupsDir); errors.Is(err, fs.ErrNotExist) {
+		logrus.Debug("No backups directory in the vault")
+		return nil, nil
+	}
+
+	projects, err := utils.GetDirectories(backupsDir)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving directories: %w", err)
+	}
+
+	var backups []Backup
+	for _, project := range projects {
+		snapshots, err := utils.GetDirectories(filepath.Join(backupsDir, project.Name))
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving backups of %s: %w", project.Name, err)
+		}
+
+		for _, snapshot := range snapshots {
+			timestamp, ok := parseSnapshotName(snapshot.Name)
+			if !ok {
+				logrus.Debugf("Skipping unknown folder in backups: %s/%s", project.Name, snapshot.Name)
+				continue
+			}
+
+			name := filepath.Join(BackupsDirName, project.Name, snapshot.Name)
+			files, err := listBackupFiles(vaultDir, filepath.Join(vaultDir, name))
+			if err != nil {
+				return nil, fmt.Errorf("error reading backup %s: %w", name, err)
+			}
+			backups = append(backups, Backup{Project: project.Name, Timestamp: timestamp, Name: name, Files: files})
+		}
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].Project != backups[j].Project {
+			return backups[i].Project < backups[j].Project
+		}
+		if !backups[i].Timestamp.Equal(backups[j].Timestamp) {
+			return backups[i].Timestamp.After(backups[j].Timestamp)
+		}
+		// Backups taken within the same second are numbered, so the longer name is the newer one.
+		if len(backups[i].Name) != len(backups[j].Name) {
+			return len(backups[i].Name) > len(backups[j].Name)
+		}
+		return backups[i].Name > backups[j].Name
+	})
+
+	logrus.Debugf("Backups found: %d", len(backups))
+	return backups, nil
+}
+
+func listBackupFiles(vaultDir, backupPath string) ([]string, error) {
+	snapshotFiles, err := listSnapshotFiles(vaultDir, backupPath, "")
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, len(snapshotFiles))
+	for i, file := range snapshotFiles {
+		files[i] = file.Path
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// BackupMigration moves one legacy backup folder from the vault root into the backups directory.
+type BackupMigration struct {
+	Source      string
+	Destination string
+}
+
+// PlanBackupMigration finds legacy `<project>-<timestamp>` folders in the vault root.
+func PlanBackupMigration(vaultDir string) ([]BackupMigration, error) {
+	directories, err := utils.GetDirectories(vaultDir)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving directories: %w", err)
+	}
+
+	var migrations []BackupMigration
+	for _, directory := range directories {
+		project, timestamp, ok := ParseBackupName(directory.Name)
+		if !ok {
+			continue
+		}
+		migrations = append(migrations, BackupMigration{
+			Source:      filepath.Join(vaultDir, directory.Name),
+			Destination: filepath.Join(BackupsDir(vaultDir), project, timestamp.Format(utils.BackupTimestampLayout)),
+		})
+	}
+	logrus.Debugf("Legacy backups to migrate: %d", len(migrations))
+	return migrations, nil
+}
+
+// MigrateBackups moves legacy backup folders into the backups directory. Folders whose destination
+// already exists are left in place and reported as an error once every other folder has been moved.
+func MigrateBackups(vaultDir string) ([]BackupMigration, error) {
+	migrations, err := PlanBackupMigration(vaultDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrated []BackupMigration
+	var conflicts []string
+	for _, migration := range migrations {
+		if _, err := os.Stat(migration.Destination); err == nil {
+			logrus.Debugf("Backup already exists, not migrating: %s", migration.Destination)
+			conflicts = append(conflicts, filepath.Base(migration.Source))
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(migration.Destination), VaultDirMode); err != nil {
+			return migrated, fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		if err := os.Rename(migration.Source, migration.Destination); err != nil {
+			return migrated, fmt.Errorf("failed to move %s: %w", migration.Source, err)
+		}
+		logrus.Debugf("Migrated backup: %s -> %s", migration.Source, migration.Destination)
+		migrated = append(migrated, migration)
+	}
+
+	if len(conflicts) > 0 {
+		return migrated, fmt.Errorf("backups already exist for: %s", strings.Join(conflicts, ", "))
+	}
+	return migrated, nil
+}
+
+// PrintBackupMigration lists the moves of a backup migration.
+func PrintBackupMigration(w io.Writer, migrations []BackupMigration, vaultDir string, dryRun bool) {
+	if len(migrations) == 0 {
+		fmt.Fprintf(w, "%s %s\n", utils.SuccessIcon(), utils.WhiteText("No legacy backups to migrate."))
+		return
+	}
+
+	verb := "Moved"
+	if dryRun {
+		fmt.Fprintf(w, "%s %s\n", utils.InfoIcon(), utils.WhiteText("Dry run, no folders will be moved:"))
+		verb = "move"
+	}
+	for _, migration := range migrations {
+		fmt.Fprintf(w, "  %s %s %s %s\n", verb, utils.CyanText(prettifiedPath(migration.Source, vaultDir)), utils.WhiteText("->"), utils.CyanText(prettifiedPath(migration.Destination, vaultDir)))
+	}
+}
+
+// FilterBackups returns the backups of a single project, keeping their order.
+func FilterBackups(backups []Backup, project string) []Backup {
+	var filtered []Backup
+	for _, backup := range backups {
+		if backup.Project == project {
+			filtered = append(filtered, backup)
+		}
+	}
+	return filtered
+}
+
+func backupLabel(backup Backup) string {
+	return fmt.Sprintf("%s  %s (%s)", backup.Project, backup.Timestamp.Format("2006-01-02 15:04:05"), describeFiles(backup.Files))
+}
+
+func describeFiles(files []string) string {
+	const shown = 3
+	switch {
+	case len(files) == 0:
+		return "no files"
+	case len(files) > shown:
+		return fmt.Sprintf("%s and %d more", strings.Join(files[:shown], ", "), len(files)-shown)
+	default:
+		return strings.Join(files, ", ")
+	}
+}
+
+var selectBackupRun = func(prompt promptui.Select) (int, string, error) {
+	return prompt.Run()
+}
+
+// SelectBackup asks the user to pick one of the backups.
+func SelectBackup(backups []Backup) (Backup, error) {
+	if len(backups) == 0 {
+		return Backup{}, fmt.Errorf("no backups found")
+	}
+
+	labels := make([]string, len(backups))
+	for i, backup := range backups {
+		labels[i] = backupLabel(backup)
+	}
+
+	prompt := promptui.Select{
+		Label: "Choose a backup to restore",
+		Items: labels,
+	}
+
+	index, _, err := selectBackupRun(prompt)
+	if err != nil {
+		if err == promptui.ErrInterrupt {
+			logrus.Debug("User aborted backup selection")
+			fmt.Printf("%s %s\n", utils.WarningIcon(), utils.WhiteText("Selection cancelled."))
+			exitFunc(0)
+		}
+		return Backup{}, fmt.Errorf("error starting the selection form: %w", err)
+	}
+
+	if index < 0 || index >= len(backups) {
+		return Backup{}, fmt.Errorf("no backup selected")
+	}
+
+	logrus.Debugf("Backup selected: %s", backups[index].Name)
+	return backups[index], nil
+}
+
+// PrintBackups lists backups grouped by project with the files each of them contains.
+func PrintBackups(w io.Writer, backups []Backup) {
+	if len(backups) == 0 {
+		fmt.Fprintf(w, "%s %s\n", utils.WarningIcon(), utils.WhiteText("No backups found."))
+		return
+	}
+
+	for i, backup := range backups {
+		if i == 0 || backup.Project != backups[i-1].Project {
+			fmt.Fprintf(w, "%s %s\n", utils.InfoIcon(), utils.CyanText(backup.Project))
+		}
+		fmt.Fprintf(w, "  %s  %s\n", backup.Timestamp.Format("2006-01-02 15:04:05"), utils.WhiteText(backup.Name))
+		for _, file := range backup.Files {
+			fmt.Fprintf(w, "    %s\n", file)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeBackup(t *testing.T, vaultDir, name string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(vaultDir, name, filepath.FromSlash(file))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("KEY=value\n"), 0644))
+	}
+}
+
+func TestParseBackupName(t *testing.T) {
+	project, timestamp, ok := ParseBackupName("my-app-2024-05-01_10-00-00")
+	assert.True(t, ok)
+	assert.Equal(t, "my-app", project)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local), timestamp)
+
+	for _, name := range []string{"my-app", "2024-05-01_10-00-00", "-2024-05-01_10-00-00", "my-app_2024-05-01_10-00-00", "my-app-2024-13-01_10-00-00"} {
+		_, _, ok := ParseBackupName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestListBackups(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, ".backups/web/2024-05-01_10-00-00", ".env")
+	writeBackup(t, vaultDir, ".backups/web/2024-06-01_10-00-00", ".env", "apps/api/.env")
+	writeBackup(t, vaultDir, ".backups/api/2024-01-01_00-00-00", ".env")
+	writeBackup(t, vaultDir, ".backups/api/not-a-timestamp", ".env")
+	writeBackup(t, vaultDir, "web", ".env")
+	writeBackup(t, vaultDir, "web-2023-01-01_00-00-00", ".env")
+
+	backups, err := ListBackups(vaultDir)
+	assert.NoError(t, err)
+	var names []string
+	for _, backup := range backups {
+		names = append(names, filepath.ToSlash(backup.Name))
+	}
+	assert.Equal(t, []string{".backups/api/2024-01-01_00-00-00", ".backups/web/2024-06-01_10-00-00", ".backups/web/2024-05-01_10-00-00"}, names)
+	assert.Equal(t, []string{".env", filepath.Join("apps", "api", ".env")}, backups[1].Files)
+	assert.Equal(t, time.Date(2024, 6, 1, 10, 0, 0, 0, time.Local), backups[1].Timestamp)
+
+	web := FilterBackups(backups, "web")
+	assert.Len(t, web, 2)
+	assert.Equal(t, "web", web[0].Project)
+	assert.Equal(t, "2024-06-01_10-00-00", filepath.Base(web[0].Name), "Expected the newest backup first")
+	assert.Empty(t, FilterBackups(backups, "missing"))
+
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	defer logrus.SetOutput(os.Stderr)
+	backups, err = ListBackups(t.TempDir())
+	assert.NoError(t, err, "Expected a vault without backups to have none")
+	assert.Empty(t, backups)
+	assert.Empty(t, logs.String(), "Expected a missing backups directory not to be logged as an error")
+}
+
+func TestMigrateBackups(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web-2024-05-01_10-00-00", ".env", "apps/.env")
+	writeBackup(t, vaultDir, "my-api-2024-01-01_00-00-00", ".env")
+	writeBackup(t, vaultDir, "web", ".env")
+
+	planned, err := PlanBackupMigration(vaultDir)
+	assert.NoError(t, err)
+	assert.Len(t, planned, 2)
+	_, err = os.Stat(filepath.Join(vaultDir, "web-2024-05-01_10-00-00"))
+	assert.NoError(t, err, "Expected planning not to move anything")
+
+	migrated, err := MigrateBackups(vaultDir)
+	assert.NoError(t, err)
+	assert.Equal(t, planned, migrated)
+
+	assert.FileExists(t, filepath.Join(vaultDir, ".backups", "web", "2024-05-01_10-00-00", "apps", ".env"))
+	assert.FileExists(t, filepath.Join(vaultDir, ".backups", "my-api", "2024-01-01_00-00-00", ".env"))
+	assert.NoDirExists(t, filepath.Join(vaultDir, "web-2024-05-01_10-00-00"))
+	assert.DirExists(t, filepath.Join(vaultDir, "web"), "Expected real projects to stay in place")
+
+	backups, err := ListBackups(vaultDir)
+	assert.NoError(t, err)
+	assert.Len(t, backups, 2)
+
+	// A second run has nothing left to do.
+	migrated, err = MigrateBackups(vaultDir)
+	assert.NoError(t, err)
+	assert.Empty(t, migrated)
+}
+
+func TestMigrateBackups_Conflict(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web-2024-05-01_10-00-00", ".env")
+	writeBackup(t, vaultDir, "api-2024-05-01_10-00-00", ".env")
+	writeBackup(t, vaultDir, ".backups/web/2024-05-01_10-00-00", ".env")
+
+	migrated, err := MigrateBackups(vaultDir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "backups already exist for: web-2024-05-01_10-00-00")
+	assert.Len(t, migrated, 1, "Expected the other backups to be migrated")
+	assert.DirExists(t, filepath.Join(vaultDir, "web-2024-05-01_10-00-00"))
+}
+
+func TestPrintBackupMigration(t *testing.T) {
+	vaultDir := t.TempDir()
+	migrations := []BackupMigration{{
+		Source:      filepath.Join(vaultDir, "web-2024-05-01_10-00-00"),
+		Destination: filepath.Join(vaultDir, ".backups", "web", "2024-05-01_10-00-00"),
+	}}
+
+	var buf bytes.Buffer
+	PrintBackupMigration(&buf, migrations, vaultDir, true)
+	assert.Contains(t, buf.String(), "Dry run")
+	assert.Contains(t, buf.String(), "move {vault}/web-2024-05-01_10-00-00 -> {vault}/.backups/web/2024-05-01_10-00-00")
+
+	buf.Reset()
+	PrintBackupMigration(&buf, nil, vaultDir, false)
+	assert.Contains(t, buf.String(), "No legacy backups to migrate.")
+}
+
+func TestSelectBackup(t *testing.T) {
+	backups := []Backup{
+		{Project: "web", Name: "web-2024-06-01_10-00-00", Files: []string{".env"}},
+		{Project: "web", Name: "web-2024-05-01_10-00-00", Files: []string{"a", "b", "c", "d"}},
+	}
+
+	origSelectRun := selectBackupRun
+	defer func() { selectBackupRun = origSelectRun }()
+
+	var items []string
+	selectBackupRun = func(prompt promptui.Select) (int, string, error) {
+		items = prompt.Items.([]string)
+		return 1, items[1], nil
+	}
+	selected, err := SelectBackup(backups)
+	assert.NoError(t, err)
+	assert.Equal(t, "web-2024-05-01_10-00-00", selected.Name)
+	assert.Contains(t, items[0], "(.env)")
+	assert.Contains(t, items[1], "a, b, c and 1 more")
+
+	selectBackupRun = func(prompt promptui.Select) (int, string, error) {
+		return 0, "", fmt.Errorf("prompt error")
+	}
+	_, err = SelectBackup(backups)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error starting the selection form")
+
+	_, err = SelectBackup(nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no backups found")
+}
+
+func TestPrintBackups(t *testing.T) {
+	var buf bytes.Buffer
+	PrintBackups(&buf, []Backup{
+		{Project: "api", Name: "api-2024-01-01_00-00-00", Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), Files: []string{".env"}},
+		{Project: "web", Name: "web-2024-06-01_10-00-00", Timestamp: time.Date(2024, 6, 1, 10, 0, 0, 0, time.Local), Files: []string{".env", "apps/.env"}},
+		{Project: "web", Name: "web-2024-05-01_10-00-00", Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)},
+	})
+	output := buf.String()
+	assert.Contains(t, output, "api")
+	assert.Contains(t, output, "2024-06-01 10:00:00")
+	assert.Contains(t, output, "    apps/.env\n")
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("web\n")), "Expected one heading per project")
+
+	buf.Reset()
+	PrintBackups(&buf, nil)
+	assert.Contains(t, buf.String(), "No backups found.")
+}
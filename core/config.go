@@ -21,6 +21,21 @@ func InitViper() error {
 	viper.SetDefault("vault_dir", ".env-files")
 	logrus.Debug("Set default vault_dir to .env-files")
 
+	viper.SetDefault("include", DefaultInclude)
+	viper.SetDefault("exclude", DefaultExclude)
+	viper.SetDefault("prune", DefaultPrune)
+	viper.SetDefault("gitignore", true)
+
+	viper.SetDefault("keep_last", 0)
+	viper.SetDefault("keep_daily", 0)
+	viper.SetDefault("keep_weekly", 0)
+
+	viper.SetDefault("identity_file", DefaultIdentityFile)
+	viper.SetDefault("file_mode", fmt.Sprintf("%04o", DefaultFileMode))
+	viper.SetDefault("opener", "")
+	viper.SetDefault("root_markers", []string{})
+	logrus.Debugf("Set default backup patterns: include: %v, exclude: %v, prune: %v", DefaultInclude, DefaultExclude, DefaultPrune)
+
 	home, err := UserHomeDirFunc()
 	if err != nil {
 		logrus.Errorf("Failed to get user home directory: %v", err)
@@ -74,6 +89,21 @@ func GetFullVaultDir(vaultDir string) (string, error) {
 	return vaultDirFull, nil
 }
 
+// GetFullIdentityFile resolves identity_file; relative paths are relative to the home directory.
+func GetFullIdentityFile(identityFile string) (string, error) {
+	if filepath.IsAbs(identityFile) {
+		return identityFile, nil
+	}
+
+	homeDir, err := UserHomeDirFunc()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	identityFileFull := filepath.Join(homeDir, identityFile)
+	logrus.Debugf("Full identity file resolved: %s", identityFileFull)
+	return identityFileFull, nil
+}
+
 func CreateVaultIfNotFound(vaultDir string) (string, error) {
 	logrus.Debugf("Ensuring vault exists for vault_dir: %s", vaultDir)
 	fullVaultDir, err := GetFullVaultDir(vaultDir)
@@ -95,7 +125,7 @@ func CreateVaultIfNotFound(vaultDir string) (string, error) {
 	}
 
 	logrus.Debugf("Vault does not exist. Creating vault directory: %s", fullVaultDir)
-	if err := os.MkdirAll(fullVaultDir, 0755); err != nil {
+	if err := os.MkdirAll(fullVaultDir, VaultDirMode); err != nil {
 		logrus.Errorf("Failed to create vault directory: %v", err)
 		return "", fmt.Errorf("failed to create vault: %w", err)
 	}
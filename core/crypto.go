@@ -0,0 +1,351 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"filippo.io/age"
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+const (
+	// RecipientsFileName marks an encrypted vault and lists the age public keys its files are encrypted to.
+	RecipientsFileName = ".recipients"
+	// ObjectKeyFileName holds the random key naming the objects of an encrypted vault, encrypted to its members
+	// like any other vault file. See (*Keys).objectName.
+	ObjectKeyFileName = ".objects-key"
+
+	// ageHeader starts every file encrypted by age, which is how encrypted vault files are told apart.
+	ageHeader = "age-encryption.org/v1\n"
+)
+
+// DefaultIdentityFile is where the private key is kept when identity_file is not configured.
+// Relative paths are resolved against the home directory, like vault_dir.
+var DefaultIdentityFile = filepath.Join(".config", "cpenv", "identity.txt")
+
+// Keys are used to read and write vault files. A nil *Keys reads and writes plaintext.
+type Keys struct {
+	// Recipients are the public keys new vault files are encrypted to. Files are written in plaintext when empty.
+	Recipients []age.Recipient
+	// Identities are the private keys used to decrypt vault files.
+	Identities []age.Identity
+
+	// objectKey names the objects of an encrypted vault. It is nil until the vault has one, or when it is not
+	// encrypted to the identities yet, which objectKeyErr tells.
+	objectKey    []byte
+	objectKeyErr error
+}
+
+// Encrypts reports whether vault files are written encrypted.
+func (k *Keys) Encrypts() bool {
+	return k != nil && len(k.Recipients) > 0
+}
+
+// IsEncrypted reports whether data was encrypted by age.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageHeader))
+}
+
+// VaultEncrypted reports whether the vault has a recipients file.
+func VaultEncrypted(vaultDir string) (bool, error) {
+	_, err := os.Stat(filepath.Join(vaultDir, RecipientsFileName))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check vault encryption: %w", err)
+}
+
+// LoadKeys reads the recipients of the vault and the identities of identityFile. A vault without a
+// recipients file is not encrypted; it only needs an identity to read files that are encrypted anyway.
+func LoadKeys(vaultDir, identityFile string) (*Keys, error) {
+	identities, err := readIdentities(identityFile)
+	if err != nil {
+		return nil, err
+	}
+	keys := &Keys{Identities: identities}
+
+	data, err := os.ReadFile(filepath.Join(vaultDir, RecipientsFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			logrus.Debugf("Vault is not encrypted: %s", vaultDir)
+			return keys, nil
+		}
+		return nil, fmt.Errorf("failed to read vault recipients: %w", err)
+	}
+
+	if keys.Recipients, err = age.ParseRecipients(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to parse vault recipients: %w", err)
+	}
+	if len(keys.Identities) == 0 {
+		return nil, fmt.Errorf("vault is encrypted but no identity was found at %s", identityFile)
+	}
+
+	// A member added since the last rekey can read nothing yet, which is only an error once objects are stored.
+	objectKey, err := ReadVaultFile(filepath.Join(vaultDir, ObjectKeyFileName), keys)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logrus.Debugf("Failed to read the object key: %v", err)
+		keys.objectKeyErr = err
+	}
+	keys.objectKey = bytes.TrimSpace(objectKey)
+	logrus.Debugf("Loaded %d recipient(s) and %d identity(ies)", len(keys.Recipients), len(keys.Identities))
+	return keys, nil
+}
+
+// readIdentities parses the identity file. A missing file has no identities.
+func readIdentities(identityFile string) ([]age.Identity, error) {
+	data, err := os.ReadFile(identityFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			logrus.Debugf("No identity file at %s", identityFile)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read identity file: %w", err)
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file %s: %w", identityFile, err)
+	}
+	return identities, nil
+}
+
+// loadOrCreateIdentity reads the identities of identityFile, generating a new X25519 identity when there is
+// none. The returned recipient is the public key of the first identity, or nil when it has none.
+func loadOrCreateIdentity(identityFile string) ([]age.Identity, age.Recipient, error) {
+	identities, err := readIdentities(identityFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(identities) > 0 {
+		if identity, ok := identities[0].(*age.X25519Identity); ok {
+			return identities, identity.Recipient(), nil
+		}
+		return identities, nil, nil
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate identity: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(identityFile), 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create identity directory: %w", err)
+	}
+	content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), identity.Recipient(), identity)
+	if err := utils.WriteFileAtomic(identityFile, []byte(content), 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to write identity file: %w", err)
+	}
+	logrus.Debugf("Generated identity in %s", identityFile)
+	return []age.Identity{identity}, identity.Recipient(), nil
+}
+
+// PublicKey returns the public key of the identity in identityFile, generating an identity when needed.
+func PublicKey(identityFile string) (string, error) {
+	_, recipient, err := loadOrCreateIdentity(identityFile)
+	if err != nil {
+		return "", err
+	}
+	if recipient == nil {
+		return "", fmt.Errorf("the identity in %s has no public key", identityFile)
+	}
+	return fmt.Sprint(recipient), nil
+}
+
+// InitEncryption makes sure there is an identity in identityFile, generating one when needed, and that the
+// vault has a recipients file. A new recipients file lists the public key of the identity.
+func InitEncryption(vaultDir, identityFile string) (*Keys, error) {
+	_, recipient, err := loadOrCreateIdentity(identityFile)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientsPath := filepath.Join(vaultDir, RecipientsFileName)
+	if encrypted, err := VaultEncrypted(vaultDir); err != nil {
+		return nil, err
+	} else if !encrypted {
+		if recipient == nil {
+			return nil, fmt.Errorf("the identity in %s has no public key to encrypt to", identityFile)
+		}
+		if err := utils.WriteFileAtomic(recipientsPath, []byte(fmt.Sprintf("%s\n", recipient)), DefaultFileMode); err != nil {
+			return nil, fmt.Errorf("failed to write vault recipients: %w", err)
+		}
+		logrus.Debugf("Wrote vault recipients: %s", recipientsPath)
+	}
+
+	keys, err := LoadKeys(vaultDir, identityFile)
+	if err != nil || len(keys.objectKey) > 0 || keys.objectKeyErr != nil {
+		return keys, err
+	}
+
+	// The key is random rather than derived from an identity, so that every member names objects alike.
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate the object key: %w", err)
+	}
+	keys.objectKey = []byte(hex.EncodeToString(secret))
+	if err := WriteVaultFile(filepath.Join(vaultDir, ObjectKeyFileName), append(keys.objectKey, '\n'), keys, DefaultFileMode); err != nil {
+		return nil, fmt.Errorf("failed to write the object key: %w", err)
+	}
+	logrus.Debugf("Wrote the object key of %s", vaultDir)
+	return keys, nil
+}
+
+// ReadVaultFile returns the plaintext contents of a vault file, decrypting it when it is encrypted.
+func ReadVaultFile(path string, keys *Keys) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	if keys == nil || len(keys.Identities) == 0 {
+		return nil, fmt.Errorf("%s is encrypted but no identity is configured", path)
+	}
+	reader, err := age.Decrypt(bytes.NewReader(data), keys.Identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return plaintext, nil
+}
+
+// WriteVaultFile writes data to a vault file, encrypted to the recipients when the vault is encrypted.
+func WriteVaultFile(path string, data []byte, keys *Keys, perm fs.FileMode) error {
+	if keys.Encrypts() {
+		var buf bytes.Buffer
+		writer, err := age.Encrypt(&buf, keys.Recipients...)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+		if _, err := writer.Write(data); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+		data = buf.Bytes()
+	}
+
+	return utils.WriteFileAtomic(path, data, perm)
+}
+
+// walkVaultFiles calls fn for every file of the vault holding env contents, skipping the recipients file,
+// manifests and journals.
+func walkVaultFiles(vaultDir string, fn func(path string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(vaultDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || d.Name() == RecipientsFileName || d.Name() == ManifestFileName {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+}
+
+// EncryptVault encrypts every plaintext file of the vault to the recipients of keys and renames the objects
+// after their keyed digest. Once ctx is canceled, the remaining files are left alone; running it again
+// finishes the job.
+func EncryptVault(ctx context.Context, vaultDir string, keys *Keys) (int, error) {
+	if !keys.Encrypts() {
+		return 0, fmt.Errorf("no recipients to encrypt to")
+	}
+
+	encrypted := 0
+	err := walkVaultFiles(vaultDir, func(path string, info fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("encryption interrupted: %w", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if IsEncrypted(data) {
+			return nil
+		}
+		if err := WriteVaultFile(path, data, keys, info.Mode().Perm()); err != nil {
+			return err
+		}
+		logrus.Debugf("Encrypted %s", path)
+		encrypted++
+		return nil
+	})
+	if err != nil {
+		return encrypted, err
+	}
+	return encrypted, renameObjects(vaultDir, keys)
+}
+
+// DecryptVault decrypts every encrypted file of the vault, renames the objects after the digest of their
+// plaintext and removes the recipients and the object key. Once ctx is canceled, the remaining files are left
+// alone and the vault stays encrypted.
+func DecryptVault(ctx context.Context, vaultDir string, keys *Keys) (int, error) {
+	decrypted := 0
+	err := walkVaultFiles(vaultDir, func(path string, info fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("decryption interrupted: %w", err)
+		}
+		// The object key is removed below instead.
+		if path == filepath.Join(vaultDir, ObjectKeyFileName) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if !IsEncrypted(data) {
+			return nil
+		}
+		plaintext, err := ReadVaultFile(path, keys)
+		if err != nil {
+			return err
+		}
+		if err := WriteVaultFile(path, plaintext, nil, info.Mode().Perm()); err != nil {
+			return err
+		}
+		logrus.Debugf("Decrypted %s", path)
+		decrypted++
+		return nil
+	})
+	if err != nil {
+		return decrypted, err
+	}
+	if err := renameObjects(vaultDir, nil); err != nil {
+		return decrypted, err
+	}
+
+	// Only stop encrypting new files once every existing file could be decrypted.
+	for _, name := range []string{RecipientsFileName, ObjectKeyFileName} {
+		if err := os.Remove(filepath.Join(vaultDir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return decrypted, fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	return decrypted, nil
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+func TestLoadKeys(t *testing.T) {
+	vaultDir := t.TempDir()
+	identityFile := filepath.Join(t.TempDir(), "identity.txt")
+
+	keys, err := LoadKeys(vaultDir, identityFile)
+	assert.NoError(t, err, "Expected a plain vault to need no identity")
+	assert.False(t, keys.Encrypts())
+
+	assert.NoError(t, os.WriteFile(filepath.Join(vaultDir, RecipientsFileName), []byte("age1invalid\n"), 0644))
+	_, err = LoadKeys(vaultDir, identityFile)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse vault recipients")
+
+	assert.NoError(t, os.Remove(filepath.Join(vaultDir, RecipientsFileName)))
+	_, err = InitEncryption(vaultDir, identityFile)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(identityFile))
+	_, err = LoadKeys(vaultDir, identityFile)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no identity was found")
+}
+
+func TestInitEncryption(t *testing.T) {
+	vaultDir := t.TempDir()
+	identityFile := filepath.Join(t.TempDir(), "cpenv", "identity.txt")
+
+	keys, err := InitEncryption(vaultDir, identityFile)
+	assert.NoError(t, err)
+	assert.True(t, keys.Encrypts())
+	assert.Len(t, keys.Identities, 1)
+
+	info, err := os.Stat(identityFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	encrypted, err := VaultEncrypted(vaultDir)
+	assert.NoError(t, err)
+	assert.True(t, encrypted)
+
+	// Running it again keeps the existing identity and recipients.
+	identity, err := os.ReadFile(identityFile)
+	assert.NoError(t, err)
+	_, err = InitEncryption(vaultDir, identityFile)
+	assert.NoError(t, err)
+	again, err := os.ReadFile(identityFile)
+	assert.NoError(t, err)
+	assert.Equal(t, identity, again)
+}
+
+func TestReadWriteVaultFile(t *testing.T) {
+	keys, err := InitEncryption(t.TempDir(), filepath.Join(t.TempDir(), "identity.txt"))
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), ".env")
+	assert.NoError(t, WriteVaultFile(path, []byte("KEY=value\n"), keys, 0644))
+	raw, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(raw))
+	assert.NotContains(t, string(raw), "KEY=value")
+
+	plaintext, err := ReadVaultFile(path, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY=value\n", string(plaintext))
+
+	_, err = ReadVaultFile(path, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no identity is configured")
+
+	other, err := InitEncryption(t.TempDir(), filepath.Join(t.TempDir(), "identity.txt"))
+	assert.NoError(t, err)
+	_, err = ReadVaultFile(path, other)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to decrypt")
+
+	// Plaintext files are read as they are.
+	assert.NoError(t, WriteVaultFile(path, []byte("KEY=plain\n"), nil, 0644))
+	plaintext, err = ReadVaultFile(path, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY=plain\n", string(plaintext))
+}
+
+func TestEncryptAndDecryptVault(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env", "apps/api/.env")
+	writeBackup(t, vaultDir, "api", ".env")
+	_, err := DedupeSnapshot(vaultDir, filepath.Join(vaultDir, "api"), nil)
+	assert.NoError(t, err)
+
+	keys, err := InitEncryption(vaultDir, filepath.Join(t.TempDir(), "identity.txt"))
+	assert.NoError(t, err)
+	files, err := EncryptVault(context.Background(), vaultDir, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, files, "Expected both project files and the object to be encrypted")
+
+	raw, err := os.ReadFile(filepath.Join(vaultDir, "web", ".env"))
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(raw))
+	_, ok, err := ReadManifest(filepath.Join(vaultDir, "api"))
+	assert.NoError(t, err)
+	assert.True(t, ok, "Expected manifests to stay readable")
+
+	files, err = EncryptVault(context.Background(), vaultDir, keys)
+	assert.NoError(t, err)
+	assert.Zero(t, files, "Expected encrypted files to be left alone")
+
+	plainName := utils.HashBytes([]byte("KEY=value\n"))
+	manifest, _, err := ReadManifest(filepath.Join(vaultDir, "api"))
+	assert.NoError(t, err)
+	if assert.Len(t, manifest.Files, 1) {
+		assert.NotEqual(t, plainName, manifest.Files[0].Hash, "Expected the object to be renamed after its keyed digest")
+		assert.FileExists(t, ObjectPath(vaultDir, manifest.Files[0].Hash))
+	}
+	assert.NoFileExists(t, ObjectPath(vaultDir, plainName))
+
+	files, err = DecryptVault(context.Background(), vaultDir, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, files)
+	manifest, _, err = ReadManifest(filepath.Join(vaultDir, "api"))
+	assert.NoError(t, err)
+	if assert.Len(t, manifest.Files, 1) {
+		assert.Equal(t, plainName, manifest.Files[0].Hash, "Expected the object to be named after its plaintext again")
+		assert.FileExists(t, ObjectPath(vaultDir, plainName))
+	}
+	assert.NoFileExists(t, filepath.Join(vaultDir, ObjectKeyFileName))
+	raw, err = os.ReadFile(filepath.Join(vaultDir, "web", ".env"))
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY=value\n", string(raw))
+	encrypted, err := VaultEncrypted(vaultDir)
+	assert.NoError(t, err)
+	assert.False(t, encrypted)
+}
+
+func TestEncryptVault_Canceled(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env")
+	keys, err := InitEncryption(vaultDir, filepath.Join(t.TempDir(), "identity.txt"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	files, err := EncryptVault(ctx, vaultDir, keys)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, files)
+	raw, err := os.ReadFile(filepath.Join(vaultDir, "web", ".env"))
+	assert.NoError(t, err)
+	assert.False(t, IsEncrypted(raw), "Expected the files after the interrupt to be left alone")
+
+	_, err = RekeyVault(ctx, vaultDir, keys)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = DecryptVault(ctx, vaultDir, keys)
+	assert.ErrorIs(t, err, context.Canceled)
+	encrypted, err := VaultEncrypted(vaultDir)
+	assert.NoError(t, err)
+	assert.True(t, encrypted, "Expected an interrupted decryption to keep the vault encrypted")
+}
+
+func TestEncryptedVault_BackupAndCopy(t *testing.T) {
+	vaultDir := t.TempDir()
+	keys, err := InitEncryption(vaultDir, filepath.Join(t.TempDir(), "identity.txt"))
+	assert.NoError(t, err)
+
+	projectDir := filepath.Join(t.TempDir(), "web")
+	assert.NoError(t, os.MkdirAll(projectDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(projectDir, ".env"), []byte("KEY=value\n"), 0644))
+
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(projectDir))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	_, err = CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: vaultDir, Keys: keys})
+	assert.NoError(t, err)
+	backups, err := ListBackups(vaultDir)
+	assert.NoError(t, err)
+	if !assert.Len(t, backups, 1) {
+		return
+	}
+	files, err := listSnapshotFiles(vaultDir, filepath.Join(vaultDir, backups[0].Name), "")
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		raw, err := os.ReadFile(files[0].Source)
+		assert.NoError(t, err)
+		assert.True(t, IsEncrypted(raw), "Expected the stored object to be encrypted")
+		assert.NotEqual(t, utils.HashBytes([]byte("KEY=value\n")), files[0].Hash, "Expected objects not to be named after the digest of their plaintext")
+		assert.Len(t, files[0].Hash, 64)
+	}
+
+	// An unchanged working tree is recognised through the encrypted backup.
+	plan, err := PlanCopyToVault(BackupOptions{VaultDir: vaultDir, Keys: keys})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, plan.Count(ActionIdentical))
+
+	assert.NoError(t, os.Remove(filepath.Join(projectDir, ".env")))
+	_, err = CopyEnvFilesToProject(context.Background(), CopyOptions{Project: backups[0].Name, VaultDir: vaultDir, Keys: keys})
+	assert.NoError(t, err)
+	restored, err := os.ReadFile(filepath.Join(projectDir, ".env"))
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY=value\n", string(restored))
+
+	diffs, err := DiffProject(CopyOptions{Project: backups[0].Name, VaultDir: vaultDir, Keys: keys})
+	assert.NoError(t, err)
+	if assert.Len(t, diffs, 1) {
+		assert.NoError(t, diffs[0].Err)
+		assert.Empty(t, diffs[0].Changes)
+	}
+}
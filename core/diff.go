@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/dotenv"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// ChangeKind describes how a key differs between the vault and the working tree.
+type ChangeKind string
+
+const (
+	// KeyAdded is a key that only exists in the working tree.
+	KeyAdded ChangeKind = "added"
+	// KeyRemoved is a key that only exists in the vault.
+	KeyRemoved ChangeKind = "removed"
+	KeyChanged ChangeKind = "changed"
+)
+
+type KeyChange struct {
+	Key        string
+	Kind       ChangeKind
+	VaultValue string
+	LocalValue string
+}
+
+// FileDiff holds the key changes of one env file of a vault project against its copy in the working tree.
+type FileDiff struct {
+	Path         string
+	VaultPath    string
+	LocalPath    string
+	LocalMissing bool
+	Changes      []KeyChange
+	// Err is set when one side could not be parsed; Changes is empty in that case.
+	Err error
+}
+
+// DiffKeys compares two sets of values. Keys are reported in vault order followed by local-only keys in local order.
+func DiffKeys(vault, local *dotenv.File) []KeyChange {
+	vaultValues := vault.Map()
+	localValues := local.Map()
+
+	var changes []KeyChange
+	for _, key := range vault.Keys() {
+		localValue, ok := localValues[key]
+		switch {
+		case !ok:
+			changes = append(changes, KeyChange{Key: key, Kind: KeyRemoved, VaultValue: vaultValues[key]})
+		case localValue != vaultValues[key]:
+			changes = append(changes, KeyChange{Key: key, Kind: KeyChanged, VaultValue: vaultValues[key], LocalValue: localValue})
+		}
+	}
+	for _, key := range local.Keys() {
+		if _, ok := vaultValues[key]; !ok {
+			changes = append(changes, KeyChange{Key: key, Kind: KeyAdded, LocalValue: localValues[key]})
+		}
+	}
+	return changes
+}
+
+// DiffProject compares the env files copy would write with the matching files in the working tree. It takes
+// the same options as CopyEnvFilesToProject: files are compared below CurrentPath of Root, with the files of
+// Profile layered on them and limited to Files when set.
+func DiffProject(opts CopyOptions) ([]FileDiff, error) {
+	logrus.Debugf("Diffing project: vault_dir: %s, project: %s, current_path: %s, root: %s", opts.VaultDir, opts.Project, opts.CurrentPath, opts.root())
+
+	filesInProject, err := listCopySources(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	destinationPath := filepath.Join(opts.root(), opts.CurrentPath)
+
+	var diffs []FileDiff
+	for _, file := range filesInProject {
+		if len(opts.Files) > 0 {
+			if _, ok := matchProjectFile(opts.Files, filepath.ToSlash(filepath.Join(opts.CurrentPath, file.Path))); !ok {
+				logrus.Debugf("Skipping file not listed in the project config: %s", file.Path)
+				continue
+			}
+		}
+		fileOpts := opts
+		fileOpts.overlay = file.Overlay
+		diffs = append(diffs, diffFile(file.Path, file.Source, filepath.Join(destinationPath, file.Path), fileOpts))
+	}
+	return diffs, nil
+}
+
+func diffFile(relativePath, vaultPath, localPath string, opts CopyOptions) FileDiff {
+	diff := FileDiff{Path: relativePath, VaultPath: vaultPath, LocalPath: localPath}
+
+	data, err := opts.readSource(vaultPath)
+	if err != nil {
+		diff.Err = err
+		return diff
+	}
+	vaultFile, err := dotenv.ParseString(string(data))
+	if err != nil {
+		diff.Err = fmt.Errorf("failed to parse %s: %w", vaultPath, err)
+		return diff
+	}
+
+	localFile := &dotenv.File{}
+	if _, err := os.Stat(localPath); os.IsNotExist(err) {
+		diff.LocalMissing = true
+	} else if localFile, err = dotenv.ParseFile(localPath); err != nil {
+		diff.Err = err
+		return diff
+	}
+
+	diff.Changes = DiffKeys(vaultFile, localFile)
+	logrus.Debugf("Diffed %s: %d change(s)", relativePath, len(diff.Changes))
+	return diff
+}
+
+func PrintDiff(w io.Writer, diffs []FileDiff, vaultDir string, reveal bool) {
+	value := func(v string) string {
+		if reveal {
+			return v
+		}
+		return utils.MaskValue(v)
+	}
+
+	changed := 0
+	for _, diff := range diffs {
+		if diff.Err == nil && !diff.LocalMissing && len(diff.Changes) == 0 {
+			continue
+		}
+		changed++
+
+		fmt.Fprintf(w, "%s %s\n", utils.InfoIcon(), utils.CyanText(prettifiedPath(diff.LocalPath, vaultDir)))
+		switch {
+		case diff.Err != nil:
+			fmt.Fprintf(w, "  %s %s\n", utils.ErrorIcon(), utils.WhiteText(diff.Err.Error()))
+			continue
+		case diff.LocalMissing:
+			fmt.Fprintf(w, "  %s %s\n", utils.WarningIcon(), utils.WhiteText("File does not exist in the working tree"))
+		}
+
+		for _, change := range diff.Changes {
+			switch change.Kind {
+			case KeyAdded:
+				fmt.Fprintf(w, "  %s %s=%s\n", utils.GreenText("+"), change.Key, value(change.LocalValue))
+			case KeyRemoved:
+				fmt.Fprintf(w, "  %s %s=%s\n", utils.RedText("-"), change.Key, value(change.VaultValue))
+			case KeyChanged:
+				fmt.Fprintf(w, "  %s %s: %s -> %s\n", utils.YellowText("~"), change.Key, value(change.VaultValue), value(change.LocalValue))
+			}
+		}
+	}
+
+	if changed == 0 {
+		fmt.Fprintf(w, "%s %s\n", utils.SuccessIcon(), utils.WhiteText("No differences between the vault and the working tree."))
+	}
+}
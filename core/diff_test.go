@@ -0,0 +1,116 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/y3owk1n/cpenv/dotenv"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+func mustParse(t *testing.T, input string) *dotenv.File {
+	t.Helper()
+	file, err := dotenv.Parse(strings.NewReader(input))
+	assert.NoError(t, err)
+	return file
+}
+
+func TestDiffKeys(t *testing.T) {
+	vault := mustParse(t, "SHARED=1\nCHANGED=vault\nVAULT_ONLY=x\n")
+	local := mustParse(t, "LOCAL_ONLY=y\nCHANGED=local\nSHARED=1\n")
+
+	changes := DiffKeys(vault, local)
+	assert.Equal(t, []KeyChange{
+		{Key: "CHANGED", Kind: KeyChanged, VaultValue: "vault", LocalValue: "local"},
+		{Key: "VAULT_ONLY", Kind: KeyRemoved, VaultValue: "x"},
+		{Key: "LOCAL_ONLY", Kind: KeyAdded, LocalValue: "y"},
+	}, changes)
+}
+
+func TestDiffKeys_Identical(t *testing.T) {
+	changes := DiffKeys(mustParse(t, "A=1\n# comment\nB=2\n"), mustParse(t, "B=2\nA=1\n"))
+	assert.Empty(t, changes)
+}
+
+func TestDiffProject(t *testing.T) {
+	vaultDir := t.TempDir()
+	projectDir := filepath.Join(vaultDir, "proj")
+	assert.NoError(t, os.MkdirAll(filepath.Join(projectDir, "apps", "web"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(projectDir, ".env"), []byte("A=1\nB=2\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(projectDir, "apps", "web", ".env"), []byte("C=3\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(projectDir, "broken.env"), []byte("NOT VALID\n"), 0644))
+
+	tempCwd := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, ".env"), []byte("A=1\nB=changed\nPORT=3000\n"), 0644))
+
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	diffs, err := DiffProject(CopyOptions{Project: "proj", VaultDir: vaultDir})
+	assert.NoError(t, err)
+	assert.Len(t, diffs, 3)
+
+	byPath := map[string]FileDiff{}
+	for _, diff := range diffs {
+		byPath[diff.Path] = diff
+	}
+
+	root := byPath[".env"]
+	assert.NoError(t, root.Err)
+	assert.False(t, root.LocalMissing)
+	assert.Equal(t, []KeyChange{
+		{Key: "B", Kind: KeyChanged, VaultValue: "2", LocalValue: "changed"},
+		{Key: "PORT", Kind: KeyAdded, LocalValue: "3000"},
+	}, root.Changes)
+
+	web := byPath[filepath.Join("apps", "web", ".env")]
+	assert.True(t, web.LocalMissing)
+	assert.Equal(t, []KeyChange{{Key: "C", Kind: KeyRemoved, VaultValue: "3"}}, web.Changes)
+
+	broken := byPath["broken.env"]
+	assert.Error(t, broken.Err)
+	assert.Empty(t, broken.Changes)
+}
+
+func TestDiffProject_ReadDirError(t *testing.T) {
+	_, err := DiffProject(CopyOptions{Project: "proj", VaultDir: filepath.Join(t.TempDir(), "nonexistent")})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error reading project path")
+}
+
+func TestPrintDiff_MasksValues(t *testing.T) {
+	diffs := []FileDiff{{
+		Path:      ".env",
+		LocalPath: "/elsewhere/.env",
+		Changes: []KeyChange{
+			{Key: "SECRET", Kind: KeyChanged, VaultValue: "vault-secret", LocalValue: "local-secret"},
+			{Key: "PORT", Kind: KeyAdded, LocalValue: "3000"},
+		},
+	}}
+
+	var buf bytes.Buffer
+	PrintDiff(&buf, diffs, "/vault", false)
+	out := buf.String()
+	assert.Contains(t, out, "SECRET")
+	assert.Contains(t, out, "PORT=****")
+	assert.NotContains(t, out, "vault-secret")
+	assert.NotContains(t, out, "local-secret")
+
+	buf.Reset()
+	PrintDiff(&buf, diffs, "/vault", true)
+	assert.Contains(t, buf.String(), "vault-secret -> local-secret")
+}
+
+func TestPrintDiff_NoDifferences(t *testing.T) {
+	var buf bytes.Buffer
+	PrintDiff(&buf, []FileDiff{{Path: ".env", LocalPath: "/elsewhere/.env"}}, "/vault", false)
+	assert.Contains(t, buf.String(), "No differences")
+}
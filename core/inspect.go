@@ -0,0 +1,229 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/dotenv"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// ProjectSummary describes a project of the vault.
+type ProjectSummary struct {
+	Name  string
+	Files int
+	// Size is the number of bytes stored for the files of the project, encrypted when the vault is.
+	Size int64
+	// Modified is the latest modification time of the files of the project.
+	Modified time.Time
+}
+
+// ListProjectSummaries summarizes every project of the vault, sorted by name.
+func ListProjectSummaries(vaultDir string) ([]ProjectSummary, error) {
+	directories, err := utils.GetDirectories(vaultDir)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving directories: %w", err)
+	}
+
+	var summaries []ProjectSummary
+	for _, directory := range directories {
+		// Dot directories such as .backups hold cpenv's own data and are not projects.
+		if strings.HasPrefix(directory.Name, ".") {
+			continue
+		}
+		files, err := listSnapshotFiles(vaultDir, filepath.Join(vaultDir, directory.Name), "")
+		if err != nil {
+			return nil, fmt.Errorf("error reading project %s: %w", directory.Name, err)
+		}
+
+		summary := ProjectSummary{Name: directory.Name, Files: len(files)}
+		for _, file := range files {
+			info, err := os.Stat(file.Source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to stat %s: %w", file.Source, err)
+			}
+			summary.Size += info.Size()
+			modified := file.ModTime
+			if modified.IsZero() {
+				modified = info.ModTime()
+			}
+			if modified.After(summary.Modified) {
+				summary.Modified = modified
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	logrus.Debugf("Summarized %d project(s) in %s", len(summaries), vaultDir)
+	return summaries, nil
+}
+
+// formatSize formats a number of bytes for humans, e.g. 1.5 KB.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, prefix := float64(size)/unit, 0
+	for value >= unit && prefix < 3 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[prefix])
+}
+
+// PrintProjectSummaries lists the projects of the vault with their file count, size and last modification.
+func PrintProjectSummaries(w io.Writer, summaries []ProjectSummary) {
+	if len(summaries) == 0 {
+		fmt.Fprintf(w, "%s %s\n", utils.WarningIcon(), utils.WhiteText("No projects found in the vault."))
+		return
+	}
+
+	width := len("PROJECT")
+	for _, summary := range summaries {
+		width = max(width, len(summary.Name))
+	}
+
+	fmt.Fprintf(w, "  %-*s  %5s  %9s  %s\n", width, "PROJECT", "FILES", "SIZE", "MODIFIED")
+	for _, summary := range summaries {
+		modified := "-"
+		if !summary.Modified.IsZero() {
+			modified = summary.Modified.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "  %s  %5d  %9s  %s\n", utils.CyanText(fmt.Sprintf("%-*s", width, summary.Name)), summary.Files, formatSize(summary.Size), modified)
+	}
+	fmt.Fprintf(w, "\n%d project(s)\n", len(summaries))
+}
+
+// ListProjectFiles returns the slash-separated paths of the files of a project, sorted.
+func ListProjectFiles(vaultDir, project string) ([]string, error) {
+	files, err := listSnapshotFiles(vaultDir, filepath.Join(vaultDir, project), "")
+	if err != nil {
+		return nil, fmt.Errorf("error reading project %s: %w", project, err)
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, filepath.ToSlash(file.Path))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// treeNode is a directory or file of PrintTree.
+type treeNode struct {
+	name     string
+	children map[string]*treeNode
+}
+
+// PrintTree draws the slash-separated paths as a file hierarchy below root.
+func PrintTree(w io.Writer, root string, paths []string) {
+	tree := &treeNode{children: map[string]*treeNode{}}
+	for _, path := range paths {
+		node := tree
+		for _, part := range strings.Split(path, "/") {
+			child, ok := node.children[part]
+			if !ok {
+				child = &treeNode{name: part, children: map[string]*treeNode{}}
+				node.children[part] = child
+			}
+			node = child
+		}
+	}
+
+	fmt.Fprintf(w, "%s\n", utils.CyanText(root))
+	printTreeChildren(w, tree, "")
+}
+
+func printTreeChildren(w io.Writer, node *treeNode, indent string) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		child := node.children[name]
+		branch, next := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, next = "└── ", "    "
+		}
+		if len(child.children) > 0 {
+			fmt.Fprintf(w, "%s%s%s\n", indent, branch, utils.CyanText(name))
+		} else {
+			fmt.Fprintf(w, "%s%s%s\n", indent, branch, name)
+		}
+		printTreeChildren(w, child, indent+next)
+	}
+}
+
+// ReadProjectFile returns the plaintext of a file of a project, given by its path relative to the project.
+func ReadProjectFile(vaultDir, project, path string, keys *Keys) ([]byte, error) {
+	files, err := listSnapshotFiles(vaultDir, filepath.Join(vaultDir, project), "")
+	if err != nil {
+		return nil, fmt.Errorf("error reading project %s: %w", project, err)
+	}
+
+	path = filepath.Clean(filepath.FromSlash(path))
+	for _, file := range files {
+		if file.Path == path {
+			return ReadVaultFile(file.Source, keys)
+		}
+	}
+	return nil, fmt.Errorf("%s not found in project %s", filepath.ToSlash(path), project)
+}
+
+// PrintEnvFile prints the contents of an env file. Values are masked unless reveal is set, keeping
+// comments, blank lines and keys so that the layout of the file is still visible. Commented out entries
+// are masked as well.
+func PrintEnvFile(w io.Writer, data []byte, reveal bool) error {
+	if reveal {
+		_, err := w.Write(data)
+		return err
+	}
+
+	file, err := dotenv.ParseString(string(data))
+	if err != nil {
+		return fmt.Errorf("cannot mask values, the file does not parse (%w); use --reveal to show it as is", err)
+	}
+	for _, line := range file.Lines {
+		if line.Kind == dotenv.LineComment {
+			fmt.Fprint(w, maskCommentedEntry(line.Raw))
+			continue
+		}
+		if line.Kind != dotenv.LineEntry {
+			fmt.Fprint(w, line.Raw)
+			continue
+		}
+		export := ""
+		if line.Export {
+			export = "export "
+		}
+		fmt.Fprintf(w, "%s%s=%s\n", export, line.Key, utils.MaskValue(line.Value))
+	}
+	return nil
+}
+
+// maskCommentedEntry masks the value of a comment holding an entry, such as `# API_KEY=secret`. Other
+// comments are returned as they are.
+func maskCommentedEntry(raw string) string {
+	entry := strings.TrimLeft(raw, "# \t")
+	file, err := dotenv.ParseString(entry)
+	if err != nil || len(file.Lines) != 1 || file.Lines[0].Kind != dotenv.LineEntry {
+		return raw
+	}
+
+	line := file.Lines[0]
+	export := ""
+	if line.Export {
+		export = "export "
+	}
+	return fmt.Sprintf("%s%s%s=%s\n", raw[:len(raw)-len(entry)], export, line.Key, utils.MaskValue(line.Value))
+}
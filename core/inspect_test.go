@@ -0,0 +1,109 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListProjectSummaries(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env", "apps/api/.env")
+	writeBackup(t, vaultDir, "api", ".env")
+	writeBackup(t, vaultDir, ".backups/web/2024-05-01_10-00-00", ".env")
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	assert.NoError(t, os.Chtimes(filepath.Join(vaultDir, "api", ".env"), modified, modified))
+	_, err := DedupeSnapshot(vaultDir, filepath.Join(vaultDir, "web"), nil)
+	assert.NoError(t, err)
+
+	summaries, err := ListProjectSummaries(vaultDir)
+	assert.NoError(t, err)
+	if !assert.Len(t, summaries, 2, "Expected dot directories not to be listed") {
+		return
+	}
+	assert.Equal(t, ProjectSummary{Name: "api", Files: 1, Size: int64(len("KEY=value\n")), Modified: summaries[0].Modified}, summaries[0])
+	assert.True(t, modified.Equal(summaries[0].Modified))
+	assert.Equal(t, "web", summaries[1].Name)
+	assert.Equal(t, 2, summaries[1].Files, "Expected files in a manifest to be counted")
+	assert.Equal(t, int64(2*len("KEY=value\n")), summaries[1].Size)
+
+	var buf bytes.Buffer
+	PrintProjectSummaries(&buf, summaries)
+	assert.Contains(t, buf.String(), "2024-05-01 10:00:00")
+	assert.Contains(t, buf.String(), "20 B")
+	assert.Contains(t, buf.String(), "2 project(s)")
+
+	buf.Reset()
+	PrintProjectSummaries(&buf, nil)
+	assert.Contains(t, buf.String(), "No projects found in the vault.")
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "0 B", formatSize(0))
+	assert.Equal(t, "1023 B", formatSize(1023))
+	assert.Equal(t, "1.5 KB", formatSize(1536))
+	assert.Equal(t, "2.0 MB", formatSize(2*1024*1024))
+}
+
+func TestPrintTree(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env", "apps/web/.env", "apps/api/.env", "apps/api/.env.local")
+
+	files, err := ListProjectFiles(vaultDir, "web")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".env", "apps/api/.env", "apps/api/.env.local", "apps/web/.env"}, files)
+
+	var buf bytes.Buffer
+	PrintTree(&buf, "web", files)
+	assert.Equal(t, `web
+├── .env
+└── apps
+    ├── api
+    │   ├── .env
+    │   └── .env.local
+    └── web
+        └── .env
+`, buf.String())
+}
+
+func TestReadProjectFile(t *testing.T) {
+	vaultDir := t.TempDir()
+	keys, err := InitEncryption(vaultDir, filepath.Join(t.TempDir(), "identity.txt"))
+	assert.NoError(t, err)
+	path := filepath.Join(vaultDir, "web", "apps", "api", ".env")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	assert.NoError(t, WriteVaultFile(path, []byte("KEY=value\n"), keys, DefaultFileMode))
+
+	data, err := ReadProjectFile(vaultDir, "web", "apps/api/.env", keys)
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY=value\n", string(data), "Expected encrypted files to be decrypted")
+
+	_, err = ReadProjectFile(vaultDir, "web", "apps/web/.env", keys)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "apps/web/.env not found in project web")
+}
+
+func TestPrintEnvFile(t *testing.T) {
+	data := []byte("# database\nexport DB_URL=postgres://secret\n\nEMPTY=\n")
+
+	var buf bytes.Buffer
+	assert.NoError(t, PrintEnvFile(&buf, data, false))
+	assert.Equal(t, "# database\nexport DB_URL=****\n\nEMPTY=\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, PrintEnvFile(&buf, data, true))
+	assert.Equal(t, string(data), buf.String())
+
+	// Commented out entries are masked, other comments are kept.
+	buf.Reset()
+	assert.NoError(t, PrintEnvFile(&buf, []byte("# API_KEY=sk-live-secret\n  #export OLD=\"value\"\n# see https://example.com\n"), false))
+	assert.Equal(t, "# API_KEY=****\n  #export OLD=****\n# see https://example.com\n", buf.String())
+
+	err := PrintEnvFile(&buf, []byte("KEY=\"unterminated\n"), false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "use --reveal")
+}
@@ -0,0 +1,426 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+const (
+	// JournalDirName is the directory below the state directory of the user holding the files overwritten by
+	// recent runs, one folder per vault and one folder per run in it.
+	JournalDirName = "journal"
+
+	journalFileName = "journal.json"
+	// journalKeepRuns is the number of runs kept in the journal; older runs can no longer be undone.
+	journalKeepRuns = 20
+)
+
+// JournalAction is what a run did to a file.
+type JournalAction string
+
+const (
+	JournalCreated  JournalAction = "created"
+	JournalModified JournalAction = "modified"
+)
+
+// JournalEntry is a file touched by a run.
+type JournalEntry struct {
+	Path   string        `json:"path"`
+	Action JournalAction `json:"action"`
+	// Previous names the file in the run folder holding the contents before the run, for modified files.
+	Previous string      `json:"previous,omitempty"`
+	Mode     fs.FileMode `json:"mode,omitempty"`
+	// Hash is the SHA-256 digest of what the run wrote. It is empty when the write failed.
+	Hash string `json:"hash,omitempty"`
+	// Dirs are the directories created for a created file, deepest first.
+	Dirs []string `json:"dirs,omitempty"`
+}
+
+// JournalRun is one copy or restore that can be undone.
+type JournalRun struct {
+	ID      string         `json:"id"`
+	Command string         `json:"command"`
+	Time    time.Time      `json:"time"`
+	Entries []JournalEntry `json:"entries"`
+}
+
+// Journal records the files touched by a run. Nothing is written until the first file is recorded.
+type Journal struct {
+	vaultDir string
+	keys     *Keys
+	dir      string
+	run      JournalRun
+}
+
+// JournalDir returns the journal of a vault. It is kept in the state directory of the user rather than in the
+// vault, since its paths only make sense on this machine and a vault may be shared by several.
+func JournalDir(vaultDir string) (string, error) {
+	stateDir, err := userStateDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the journal: %w", err)
+	}
+	// Vaults are told apart by a digest of their path, so that undo only sees the runs of the current vault.
+	return filepath.Join(stateDir, JournalDirName, utils.HashBytes([]byte(vaultDir))[:16]), nil
+}
+
+// userStateDir returns the directory cpenv keeps its state in. It follows XDG_STATE_HOME, which defaults to
+// ~/.local/state, except on Windows and macOS where the application data of the user is used.
+func userStateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "cpenv"), nil
+	}
+
+	var dir string
+	var err error
+	switch runtime.GOOS {
+	case "windows":
+		// %LocalAppData%, which is not synced to other machines.
+		dir, err = os.UserCacheDir()
+	case "darwin":
+		// ~/Library/Application Support
+		dir, err = os.UserConfigDir()
+	default:
+		dir, err = UserHomeDirFunc()
+		dir = filepath.Join(dir, ".local", "state")
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cpenv"), nil
+}
+
+// missingDirs returns dir and its parents that do not exist yet, deepest first.
+func missingDirs(dir string) ([]string, error) {
+	var dirs []string
+	for ; ; dir = filepath.Dir(dir) {
+		_, err := os.Stat(dir)
+		if err == nil {
+			return dirs, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to stat %s: %w", dir, err)
+		}
+		if filepath.Dir(dir) == dir {
+			return dirs, nil
+		}
+		dirs = append(dirs, dir)
+	}
+}
+
+// NewJournal starts the journal of a run described by command, e.g. "copy web".
+func NewJournal(vaultDir string, keys *Keys, command string) *Journal {
+	return &Journal{vaultDir: vaultDir, keys: keys, run: JournalRun{Command: command, Time: time.Now()}}
+}
+
+// Len returns the number of files recorded so far.
+func (j *Journal) Len() int {
+	return len(j.run.Entries)
+}
+
+// Record keeps the current contents of path before it is written. Recording a path twice keeps the
+// contents from before the first write.
+func (j *Journal) Record(path string) error {
+	for _, entry := range j.run.Entries {
+		if entry.Path == path {
+			return nil
+		}
+	}
+	if err := j.open(); err != nil {
+		return err
+	}
+
+	entry := JournalEntry{Path: path, Action: JournalCreated}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		entry.Action = JournalModified
+		entry.Mode = info.Mode().Perm()
+		entry.Previous = strconv.Itoa(len(j.run.Entries))
+		if err := WriteVaultFile(filepath.Join(j.dir, entry.Previous), data, j.keys, DefaultFileMode); err != nil {
+			return fmt.Errorf("failed to keep previous contents of %s: %w", path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		entry.Dirs, err = missingDirs(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	j.run.Entries = append(j.run.Entries, entry)
+	logrus.Debugf("Journaled %s (%s) in %s", path, entry.Action, j.dir)
+	return j.save()
+}
+
+// Written stores the digest of what the run wrote to path, so that undo can tell when the file was edited since.
+func (j *Journal) Written(path string) error {
+	for i, entry := range j.run.Entries {
+		if entry.Path != path {
+			continue
+		}
+		hash, err := utils.HashFile(path)
+		if err != nil {
+			return err
+		}
+		j.run.Entries[i].Hash = hash
+		return j.save()
+	}
+	return fmt.Errorf("%s was not recorded in the journal", path)
+}
+
+// open creates the folder of the run and removes the oldest runs.
+func (j *Journal) open() error {
+	if j.dir != "" {
+		return nil
+	}
+
+	root, err := JournalDir(j.vaultDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, VaultDirMode); err != nil {
+		return fmt.Errorf("failed to create journal: %w", err)
+	}
+
+	id := j.run.Time.Format(utils.BackupTimestampLayout)
+	for i := 2; ; i++ {
+		err := os.Mkdir(filepath.Join(root, id), VaultDirMode)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("failed to create journal: %w", err)
+		}
+		id = fmt.Sprintf("%s-%d", j.run.Time.Format(utils.BackupTimestampLayout), i)
+	}
+	j.run.ID = id
+	j.dir = filepath.Join(root, id)
+
+	// The new run has no journal file yet, so it is not counted.
+	if err := pruneJournal(j.vaultDir, journalKeepRuns-1); err != nil {
+		logrus.Debugf("Failed to prune journal: %v", err)
+	}
+	return nil
+}
+
+func (j *Journal) save() error {
+	data, err := json.MarshalIndent(j.run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode journal: %w", err)
+	}
+	if err := utils.WriteFileAtomic(filepath.Join(j.dir, journalFileName), append(data, '\n'), DefaultFileMode); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// ListJournalRuns returns the runs of the vault that can be undone on this machine, newest first.
+func ListJournalRuns(vaultDir string) ([]JournalRun, error) {
+	root, err := JournalDir(vaultDir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var runs []JournalRun
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, entry.Name(), journalFileName))
+		if err != nil {
+			logrus.Debugf("Skipping journal folder without a journal: %s", entry.Name())
+			continue
+		}
+		var run JournalRun
+		if err := json.Unmarshal(data, &run); err != nil {
+			return nil, fmt.Errorf("failed to parse journal %s: %w", entry.Name(), err)
+		}
+		run.ID = entry.Name()
+		runs = append(runs, run)
+	}
+
+	sort.SliceStable(runs, func(i, k int) bool {
+		if !runs[i].Time.Equal(runs[k].Time) {
+			return runs[i].Time.After(runs[k].Time)
+		}
+		return runs[i].ID > runs[k].ID
+	})
+	return runs, nil
+}
+
+// pruneJournal removes all but the newest keep runs.
+func pruneJournal(vaultDir string, keep int) error {
+	runs, err := ListJournalRuns(vaultDir)
+	if err != nil {
+		return err
+	}
+	root, err := JournalDir(vaultDir)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(runs); i++ {
+		if err := os.RemoveAll(filepath.Join(root, runs[i].ID)); err != nil {
+			return err
+		}
+		logrus.Debugf("Removed old journal run: %s", runs[i].ID)
+	}
+	return nil
+}
+
+// UndoAction is what undoing a run does to a file.
+type UndoAction string
+
+const (
+	UndoRestore UndoAction = "restore"
+	UndoRemove  UndoAction = "remove"
+	UndoSkip    UndoAction = "skip"
+)
+
+const (
+	undoChangedReason    = "changed since this run, use --force to undo anyway"
+	undoNotWrittenReason = "not written by this run"
+	undoRemovedReason    = "already removed"
+)
+
+// UndoStep is the planned outcome of undoing one file of a run.
+type UndoStep struct {
+	Entry  JournalEntry
+	Action UndoAction
+	// Reason explains why a file is skipped.
+	Reason string
+}
+
+// PlanUndo decides what undoing the run does to every file, newest first. Files edited since the run are
+// skipped unless force is set.
+func PlanUndo(run JournalRun, force bool) ([]UndoStep, error) {
+	var steps []UndoStep
+	for i := len(run.Entries) - 1; i >= 0; i-- {
+		entry := run.Entries[i]
+		step := UndoStep{Entry: entry, Action: UndoRestore}
+		if entry.Action == JournalCreated {
+			step.Action = UndoRemove
+		}
+
+		current, err := utils.HashFile(entry.Path)
+		exists := err == nil
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		switch {
+		case entry.Hash == "":
+			step.Action, step.Reason = UndoSkip, undoNotWrittenReason
+		case entry.Action == JournalCreated && !exists:
+			step.Action, step.Reason = UndoSkip, undoRemovedReason
+		case exists && current != entry.Hash && !force:
+			step.Action, step.Reason = UndoSkip, undoChangedReason
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// UndoRun applies the planned steps and removes the run from the journal once every file was undone. The
+// directories created for a removed file are removed too when they are empty.
+func UndoRun(vaultDir string, run JournalRun, steps []UndoStep, keys *Keys) error {
+	root, err := JournalDir(vaultDir)
+	if err != nil {
+		return err
+	}
+	runDir := filepath.Join(root, run.ID)
+	skipped := 0
+	for _, step := range steps {
+		path := step.Entry.Path
+		switch step.Action {
+		case UndoRestore:
+			data, err := ReadVaultFile(filepath.Join(runDir, step.Entry.Previous), keys)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(path), VaultDirMode); err != nil {
+				return fmt.Errorf("failed to create directory for %s: %w", path, err)
+			}
+			if err := utils.WriteFileAtomic(path, data, step.Entry.Mode); err != nil {
+				return err
+			}
+			logrus.Debugf("Restored %s", path)
+		case UndoRemove:
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+			logrus.Debugf("Removed %s", path)
+			for _, dir := range step.Entry.Dirs {
+				// Remove fails on purpose when the directory holds files the run did not create.
+				if err := os.Remove(dir); err != nil {
+					break
+				}
+				logrus.Debugf("Removed directory %s", dir)
+			}
+		default:
+			if step.Reason == undoChangedReason {
+				skipped++
+			}
+		}
+	}
+
+	// Keep runs with skipped files, so that they can still be undone with --force.
+	if skipped > 0 {
+		return nil
+	}
+	if err := os.RemoveAll(runDir); err != nil {
+		return fmt.Errorf("failed to remove journal run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// PrintJournalRuns lists the runs that can be undone.
+func PrintJournalRuns(w io.Writer, runs []JournalRun) {
+	if len(runs) == 0 {
+		fmt.Fprintf(w, "%s %s\n", utils.InfoIcon(), utils.WhiteText("Nothing to undo."))
+		return
+	}
+	for _, run := range runs {
+		fmt.Fprintf(w, "  %s  %s  %s (%d file(s))\n", utils.CyanText(run.ID), run.Time.Format("2006-01-02 15:04:05"), run.Command, len(run.Entries))
+	}
+}
+
+// PrintUndo lists what undoing a run does or did.
+func PrintUndo(w io.Writer, run JournalRun, steps []UndoStep, vaultDir string, dryRun bool) {
+	if dryRun {
+		fmt.Fprintf(w, "%s %s\n", utils.InfoIcon(), utils.WhiteText("Dry run, no files will be changed:"))
+	}
+	fmt.Fprintf(w, "%s %s %s (%s)\n", utils.InfoIcon(), utils.WhiteText("Undoing"), utils.CyanText(run.Command), run.Time.Format("2006-01-02 15:04:05"))
+
+	for _, step := range steps {
+		path := utils.CyanText(prettifiedPath(step.Entry.Path, vaultDir))
+		if step.Action == UndoSkip {
+			fmt.Fprintf(w, "  %-7s %s (%s)\n", step.Action, path, step.Reason)
+			continue
+		}
+		fmt.Fprintf(w, "  %-7s %s\n", step.Action, path)
+	}
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// useTempHome points the state directory holding the journal to a temporary home.
+func useTempHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	original := UserHomeDirFunc
+	t.Cleanup(func() { UserHomeDirFunc = original })
+	UserHomeDirFunc = func() (string, error) {
+		return home, nil
+	}
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, ".local", "state"))
+	return home
+}
+
+func TestJournal_UndoCopy(t *testing.T) {
+	useTempHome(t)
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env", "apps/api/.env")
+
+	tempCwd := t.TempDir()
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, ".env"), []byte("HAND=edited\n"), 0640))
+
+	journal := NewJournal(vaultDir, nil, "copy web")
+	_, err = CopyEnvFilesToProject(context.Background(), CopyOptions{Project: "web", VaultDir: vaultDir, Overwrite: OverwriteAlways, Journal: journal})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, journal.Len())
+
+	runs, err := ListJournalRuns(vaultDir)
+	assert.NoError(t, err)
+	if !assert.Len(t, runs, 1) {
+		return
+	}
+	assert.Equal(t, "copy web", runs[0].Command)
+
+	steps, err := PlanUndo(runs[0], false)
+	assert.NoError(t, err)
+	actions := map[string]UndoAction{}
+	for _, step := range steps {
+		actions[step.Entry.Path] = step.Action
+	}
+	assert.Equal(t, map[string]UndoAction{
+		filepath.Join(tempCwd, ".env"):                UndoRestore,
+		filepath.Join(tempCwd, "apps", "api", ".env"): UndoRemove,
+	}, actions)
+
+	var buf bytes.Buffer
+	PrintUndo(&buf, runs[0], steps, vaultDir, true)
+	assert.Contains(t, buf.String(), "restore {project}/.env")
+	assert.Contains(t, buf.String(), "remove  {project}/apps/api/.env")
+
+	assert.NoError(t, UndoRun(vaultDir, runs[0], steps, nil))
+	data, err := os.ReadFile(filepath.Join(tempCwd, ".env"))
+	assert.NoError(t, err)
+	assert.Equal(t, "HAND=edited\n", string(data))
+	info, err := os.Stat(filepath.Join(tempCwd, ".env"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assert.NoFileExists(t, filepath.Join(tempCwd, "apps", "api", ".env"))
+	assert.NoDirExists(t, filepath.Join(tempCwd, "apps"), "Expected the directories created by the run to be removed")
+
+	runs, err = ListJournalRuns(vaultDir)
+	assert.NoError(t, err)
+	assert.Empty(t, runs, "Expected an undone run to leave the journal")
+}
+
+func TestJournal_SkipsEditedFiles(t *testing.T) {
+	useTempHome(t)
+	vaultDir := t.TempDir()
+	keys, err := InitEncryption(vaultDir, filepath.Join(t.TempDir(), "identity.txt"))
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), ".env")
+	assert.NoError(t, os.WriteFile(path, []byte("SECRET=before\n"), 0600))
+
+	journal := NewJournal(vaultDir, keys, "copy web")
+	assert.NoError(t, journal.Record(path))
+	assert.NoError(t, os.WriteFile(path, []byte("SECRET=copied\n"), 0600))
+	assert.NoError(t, journal.Written(path))
+	assert.Error(t, journal.Written(filepath.Join(t.TempDir(), "other.env")))
+
+	runs, err := ListJournalRuns(vaultDir)
+	assert.NoError(t, err)
+	if !assert.Len(t, runs, 1) {
+		return
+	}
+	journalDir, err := JournalDir(vaultDir)
+	assert.NoError(t, err)
+	previous, err := os.ReadFile(filepath.Join(journalDir, runs[0].ID, runs[0].Entries[0].Previous))
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(previous), "Expected the previous contents to be encrypted like the vault")
+
+	// An edit after the run is not reverted without force.
+	assert.NoError(t, os.WriteFile(path, []byte("SECRET=edited\n"), 0600))
+	steps, err := PlanUndo(runs[0], false)
+	assert.NoError(t, err)
+	assert.Equal(t, UndoSkip, steps[0].Action)
+	assert.NoError(t, UndoRun(vaultDir, runs[0], steps, keys))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "SECRET=edited\n", string(data))
+	runs, err = ListJournalRuns(vaultDir)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1, "Expected a partially undone run to be kept")
+
+	steps, err = PlanUndo(runs[0], true)
+	assert.NoError(t, err)
+	assert.Equal(t, UndoRestore, steps[0].Action)
+	assert.NoError(t, UndoRun(vaultDir, runs[0], steps, keys))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "SECRET=before\n", string(data))
+}
+
+func TestJournal_Prune(t *testing.T) {
+	useTempHome(t)
+	vaultDir := t.TempDir()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < journalKeepRuns+2; i++ {
+		journal := NewJournal(vaultDir, nil, "copy web")
+		journal.run.Time = start.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, journal.Record(filepath.Join(t.TempDir(), ".env")))
+	}
+
+	runs, err := ListJournalRuns(vaultDir)
+	assert.NoError(t, err)
+	assert.Len(t, runs, journalKeepRuns)
+	assert.Equal(t, "2024-05-01_10-21-00", runs[0].ID, "Expected the newest run first")
+
+	var buf bytes.Buffer
+	PrintJournalRuns(&buf, runs[:1])
+	assert.Contains(t, buf.String(), "2024-05-01_10-21-00")
+	assert.Contains(t, buf.String(), "copy web (1 file(s))")
+	buf.Reset()
+	PrintJournalRuns(&buf, nil)
+	assert.Contains(t, buf.String(), "Nothing to undo.")
+}
+
+func TestJournal_KeptOutsideOfTheVault(t *testing.T) {
+	home := useTempHome(t)
+	vaultDir := t.TempDir()
+	otherVault := t.TempDir()
+
+	journalDir, err := JournalDir(vaultDir)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(journalDir, home), "Expected the journal in the home of the user")
+	otherDir, err := JournalDir(otherVault)
+	assert.NoError(t, err)
+	assert.NotEqual(t, journalDir, otherDir, "Expected every vault to have its own journal")
+
+	assert.NoError(t, NewJournal(vaultDir, nil, "copy web").Record(filepath.Join(t.TempDir(), ".env")))
+	assert.NoDirExists(t, filepath.Join(vaultDir, JournalDirName))
+	runs, err := ListJournalRuns(otherVault)
+	assert.NoError(t, err)
+	assert.Empty(t, runs, "Expected the runs of another vault to be left out")
+}
+
+func TestJournalDir_StateHome(t *testing.T) {
+	home := useTempHome(t)
+	vaultDir := t.TempDir()
+
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	journalDir, err := JournalDir(vaultDir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(stateHome, "cpenv", JournalDirName), filepath.Dir(journalDir))
+
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return
+	}
+	// A relative XDG_STATE_HOME is ignored, like an unset one.
+	for _, value := range []string{"", "state"} {
+		t.Setenv("XDG_STATE_HOME", value)
+		journalDir, err = JournalDir(vaultDir)
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(home, ".local", "state", "cpenv", JournalDirName), filepath.Dir(journalDir), value)
+	}
+}
+
+func TestJournal_KeepsSharedDirectories(t *testing.T) {
+	useTempHome(t)
+	project := t.TempDir()
+	path := filepath.Join(project, "apps", "api", ".env")
+
+	journal := NewJournal(t.TempDir(), nil, "copy web")
+	assert.NoError(t, journal.Record(path))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte("KEY=value\n"), 0600))
+	assert.NoError(t, journal.Written(path))
+	assert.Equal(t, []string{filepath.Join(project, "apps", "api"), filepath.Join(project, "apps")}, journal.run.Entries[0].Dirs)
+
+	// A file added by hand keeps its directory.
+	assert.NoError(t, os.WriteFile(filepath.Join(project, "apps", "notes.txt"), nil, 0644))
+	steps, err := PlanUndo(journal.run, false)
+	assert.NoError(t, err)
+	assert.NoError(t, UndoRun(journal.vaultDir, journal.run, steps, nil))
+	assert.NoDirExists(t, filepath.Join(project, "apps", "api"))
+	assert.FileExists(t, filepath.Join(project, "apps", "notes.txt"))
+}
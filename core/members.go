@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// Member is a teammate whose public key the vault is encrypted to.
+type Member struct {
+	// Name is taken from the comment line right above the key in the recipients file and may be empty.
+	Name string
+	// PublicKey is an age X25519 public key, e.g. age1...
+	PublicKey string
+}
+
+func (m Member) label() string {
+	if m.Name == "" {
+		return m.PublicKey
+	}
+	return fmt.Sprintf("%s (%s)", m.Name, m.PublicKey)
+}
+
+// ListMembers reads the recipients file of an encrypted vault.
+func ListMembers(vaultDir string) ([]Member, error) {
+	file, err := os.Open(filepath.Join(vaultDir, RecipientsFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("vault is not encrypted, run `cpenv vault encrypt` first")
+		}
+		return nil, fmt.Errorf("failed to read vault recipients: %w", err)
+	}
+	defer file.Close()
+
+	var members []Member
+	name := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			name = ""
+		case strings.HasPrefix(line, "#"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		default:
+			members = append(members, Member{Name: name, PublicKey: line})
+			name = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read vault recipients: %w", err)
+	}
+	return members, nil
+}
+
+func writeMembers(vaultDir string, members []Member) error {
+	var b strings.Builder
+	for _, member := range members {
+		if member.Name != "" {
+			fmt.Fprintf(&b, "# %s\n", member.Name)
+		}
+		fmt.Fprintf(&b, "%s\n", member.PublicKey)
+	}
+
+	if err := utils.WriteFileAtomic(filepath.Join(vaultDir, RecipientsFileName), []byte(b.String()), DefaultFileMode); err != nil {
+		return fmt.Errorf("failed to write vault recipients: %w", err)
+	}
+	logrus.Debugf("Wrote %d vault recipient(s)", len(members))
+	return nil
+}
+
+// AddMember adds a public key to the recipients of an encrypted vault. Files already in the vault stay
+// unreadable for the new member until the vault is rekeyed.
+func AddMember(vaultDir string, member Member) error {
+	member.PublicKey = strings.TrimSpace(member.PublicKey)
+	member.Name = strings.TrimSpace(member.Name)
+	if _, err := age.ParseX25519Recipient(member.PublicKey); err != nil {
+		return fmt.Errorf("invalid public key %q: %w", member.PublicKey, err)
+	}
+
+	members, err := ListMembers(vaultDir)
+	if err != nil {
+		return err
+	}
+	for _, existing := range members {
+		if existing.PublicKey == member.PublicKey {
+			return fmt.Errorf("%s is already a member of the vault", existing.label())
+		}
+	}
+
+	return writeMembers(vaultDir, append(members, member))
+}
+
+// RemoveMember removes the member with the given name or public key. The last member cannot be removed,
+// decrypt the vault instead.
+func RemoveMember(vaultDir, nameOrKey string) (Member, error) {
+	members, err := ListMembers(vaultDir)
+	if err != nil {
+		return Member{}, err
+	}
+
+	index := -1
+	for i, member := range members {
+		if member.PublicKey != nameOrKey && (member.Name == "" || member.Name != nameOrKey) {
+			continue
+		}
+		if index >= 0 {
+			return Member{}, fmt.Errorf("more than one member is named %q, remove it by public key", nameOrKey)
+		}
+		index = i
+	}
+	if index < 0 {
+		return Member{}, fmt.Errorf("no member found for %q", nameOrKey)
+	}
+	if len(members) == 1 {
+		return Member{}, fmt.Errorf("cannot remove the last member, run `cpenv vault decrypt` instead")
+	}
+
+	removed := members[index]
+	members = append(members[:index], members[index+1:]...)
+	return removed, writeMembers(vaultDir, members)
+}
+
+// PrintMembers lists the members of the vault.
+func PrintMembers(w io.Writer, members []Member) {
+	for _, member := range members {
+		name := member.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		fmt.Fprintf(w, "  %s %s\n", utils.CyanText(name), member.PublicKey)
+	}
+	fmt.Fprintf(w, "\n%d member(s)\n", len(members))
+}
+
+// RekeyVault re-encrypts every file of the vault to the current recipients, so that new members can read
+// them and removed members can no longer decrypt them. Once ctx is canceled, the remaining files are left
+// encrypted to the previous recipients.
+func RekeyVault(ctx context.Context, vaultDir string, keys *Keys) (int, error) {
+	if !keys.Encrypts() {
+		return 0, fmt.Errorf("vault is not encrypted, run `cpenv vault encrypt` first")
+	}
+
+	rekeyed := 0
+	err := walkVaultFiles(vaultDir, func(path string, info fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("rekey interrupted: %w", err)
+		}
+		plaintext, err := ReadVaultFile(path, keys)
+		if err != nil {
+			return err
+		}
+		if err := WriteVaultFile(path, plaintext, keys, info.Mode().Perm()); err != nil {
+			return err
+		}
+		logrus.Debugf("Rekeyed %s", path)
+		// The object key is rekeyed with the files but not counted as one.
+		if path != filepath.Join(vaultDir, ObjectKeyFileName) {
+			rekeyed++
+		}
+		return nil
+	})
+	return rekeyed, err
+}
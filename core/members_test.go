@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembers(t *testing.T) {
+	vaultDir := t.TempDir()
+	_, err := ListMembers(vaultDir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "vault is not encrypted")
+
+	ownerKey, err := PublicKey(filepath.Join(t.TempDir(), "owner.txt"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(vaultDir, RecipientsFileName), []byte(ownerKey+"\n"), 0644))
+
+	aliceKey, err := PublicKey(filepath.Join(t.TempDir(), "alice.txt"))
+	assert.NoError(t, err)
+	assert.NoError(t, AddMember(vaultDir, Member{Name: "alice", PublicKey: aliceKey}))
+
+	err = AddMember(vaultDir, Member{PublicKey: aliceKey})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "alice")
+	assert.Contains(t, err.Error(), "already a member")
+	err = AddMember(vaultDir, Member{PublicKey: "ssh-ed25519 AAAA"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid public key")
+
+	members, err := ListMembers(vaultDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []Member{{PublicKey: ownerKey}, {Name: "alice", PublicKey: aliceKey}}, members)
+
+	var buf bytes.Buffer
+	PrintMembers(&buf, members)
+	assert.Contains(t, buf.String(), "(unnamed)")
+	assert.Contains(t, buf.String(), "2 member(s)")
+
+	_, err = RemoveMember(vaultDir, "bob")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `no member found for "bob"`)
+
+	removed, err := RemoveMember(vaultDir, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, aliceKey, removed.PublicKey)
+
+	_, err = RemoveMember(vaultDir, ownerKey)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot remove the last member")
+}
+
+func TestRekeyVault(t *testing.T) {
+	vaultDir := t.TempDir()
+	ownerIdentity := filepath.Join(t.TempDir(), "owner.txt")
+	aliceIdentity := filepath.Join(t.TempDir(), "alice.txt")
+
+	writeBackup(t, vaultDir, "web", ".env")
+	owner, err := InitEncryption(vaultDir, ownerIdentity)
+	assert.NoError(t, err)
+	_, err = EncryptVault(context.Background(), vaultDir, owner)
+	assert.NoError(t, err)
+
+	aliceKey, err := PublicKey(aliceIdentity)
+	assert.NoError(t, err)
+	assert.NoError(t, AddMember(vaultDir, Member{Name: "alice", PublicKey: aliceKey}))
+
+	alice, err := LoadKeys(vaultDir, aliceIdentity)
+	assert.NoError(t, err)
+	_, err = ReadVaultFile(filepath.Join(vaultDir, "web", ".env"), alice)
+	assert.Error(t, err, "Expected a new member to need a rekey first")
+	_, err = alice.objectName([]byte("KEY=value\n"))
+	assert.ErrorContains(t, err, "cpenv vault rekey")
+
+	owner, err = LoadKeys(vaultDir, ownerIdentity)
+	assert.NoError(t, err)
+	files, err := RekeyVault(context.Background(), vaultDir, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, files)
+
+	plaintext, err := ReadVaultFile(filepath.Join(vaultDir, "web", ".env"), alice)
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY=value\n", string(plaintext))
+
+	// Every member names objects alike.
+	alice, err = LoadKeys(vaultDir, aliceIdentity)
+	assert.NoError(t, err)
+	aliceName, err := alice.objectName([]byte("KEY=value\n"))
+	assert.NoError(t, err)
+	ownerName, err := owner.objectName([]byte("KEY=value\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, ownerName, aliceName)
+
+	// After removing the owner and rekeying, only alice can read the vault.
+	ownerKey, err := PublicKey(ownerIdentity)
+	assert.NoError(t, err)
+	_, err = RemoveMember(vaultDir, ownerKey)
+	assert.NoError(t, err)
+	alice, err = LoadKeys(vaultDir, aliceIdentity)
+	assert.NoError(t, err)
+	_, err = RekeyVault(context.Background(), vaultDir, alice)
+	assert.NoError(t, err)
+	_, err = ReadVaultFile(filepath.Join(vaultDir, "web", ".env"), owner)
+	assert.Error(t, err)
+
+	_, err = RekeyVault(context.Background(), t.TempDir(), &Keys{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,488 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+const (
+	// ObjectsDirName is the vault directory holding file contents by digest as `ab/cdef...`, see (*Keys).objectName.
+	ObjectsDirName = ".objects"
+	// ManifestFileName marks a snapshot directory whose files live in the object store.
+	ManifestFileName = ".cpenv-manifest.json"
+
+	manifestVersion = 1
+)
+
+// ManifestEntry is one file of a snapshot.
+type ManifestEntry struct {
+	// Path is slash-separated and relative to the snapshot directory.
+	Path    string      `json:"path"`
+	Hash    string      `json:"hash"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+}
+
+// Manifest lists the files of a project or backup stored in the object store.
+type Manifest struct {
+	Version int             `json:"version"`
+	Files   []ManifestEntry `json:"files"`
+}
+
+// ObjectPath returns where the object with the given name is stored, see (*Keys).objectName. Names read from
+// a manifest are checked by ReadManifest.
+func ObjectPath(vaultDir, hash string) string {
+	return filepath.Join(vaultDir, ObjectsDirName, hash[:2], hash[2:])
+}
+
+// objectName returns the name of the object holding data. Objects of a plaintext vault are named after the
+// SHA-256 digest of their contents. In an encrypted vault that digest would let anyone reading the vault or
+// its manifests confirm a guessed value, so objects are named after an HMAC-SHA256 keyed with the object key
+// of the vault instead. Both are 64 hex characters.
+func (k *Keys) objectName(data []byte) (string, error) {
+	if !k.Encrypts() {
+		return utils.HashBytes(data), nil
+	}
+	if k.objectKeyErr != nil {
+		return "", fmt.Errorf("cannot read the object key, ask a member to run `cpenv vault rekey`: %w", k.objectKeyErr)
+	}
+	if len(k.objectKey) == 0 {
+		return "", fmt.Errorf("the vault has no object key, run `cpenv vault encrypt` to create one")
+	}
+	mac := hmac.New(sha256.New, k.objectKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// StoreObject copies the file into the object store unless the same contents are already stored.
+// Objects are named by objectName and encrypted to the recipients of keys.
+func StoreObject(vaultDir, sourcePath string, keys *Keys) (ManifestEntry, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to stat file %s: %w", sourcePath, err)
+	}
+
+	data, err := ReadVaultFile(sourcePath, keys)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	hash, err := keys.objectName(data)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	entry := ManifestEntry{Hash: hash, Mode: info.Mode().Perm(), ModTime: info.ModTime().UTC()}
+
+	objectPath := ObjectPath(vaultDir, hash)
+	if _, err := os.Stat(objectPath); err == nil {
+		logrus.Debugf("Object already stored: %s", hash)
+		return entry, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(objectPath), VaultDirMode); err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to create object directory: %w", err)
+	}
+
+	if err := WriteVaultFile(objectPath, data, keys, DefaultFileMode); err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to store object %s: %w", hash, err)
+	}
+	logrus.Debugf("Stored object %s from %s", hash, sourcePath)
+	return entry, nil
+}
+
+// ReadManifest reads the manifest of a snapshot directory. ok is false when the directory has no manifest.
+func ReadManifest(dir string) (manifest Manifest, ok bool, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Manifest{}, false, nil
+		}
+		return Manifest{}, false, fmt.Errorf("failed to read manifest in %s: %w", dir, err)
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, false, fmt.Errorf("failed to parse manifest in %s: %w", dir, err)
+	}
+	if manifest.Version != manifestVersion {
+		return Manifest{}, false, fmt.Errorf("unsupported manifest version %d in %s", manifest.Version, dir)
+	}
+	for _, entry := range manifest.Files {
+		if err := validateManifestEntry(entry); err != nil {
+			return Manifest{}, false, fmt.Errorf("corrupt manifest in %s: %w", dir, err)
+		}
+	}
+	return manifest, true, nil
+}
+
+// validateManifestEntry checks that an entry names an object and stays inside the snapshot, so that a
+// tampered manifest in a shared vault cannot make copy or restore write anywhere else.
+func validateManifestEntry(entry ManifestEntry) error {
+	if !isObjectHash(entry.Hash) {
+		return fmt.Errorf("invalid hash %q for %q", entry.Hash, entry.Path)
+	}
+	clean := path.Clean(entry.Path)
+	if entry.Path == "" || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") ||
+		path.IsAbs(entry.Path) || strings.Contains(entry.Path, `\`) || filepath.VolumeName(filepath.FromSlash(entry.Path)) != "" {
+		return fmt.Errorf("invalid path %q", entry.Path)
+	}
+	return nil
+}
+
+// isObjectHash reports whether hash is 64 lowercase hex characters, as objects are named.
+func isObjectHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	for i := 0; i < len(hash); i++ {
+		if c := hash[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteManifest writes the manifest into the snapshot directory, sorted by path.
+func WriteManifest(dir string, manifest Manifest) error {
+	manifest.Version = manifestVersion
+	if manifest.Files == nil {
+		manifest.Files = []ManifestEntry{}
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, VaultDirMode); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	if err := utils.WriteFileAtomic(filepath.Join(dir, ManifestFileName), append(data, '\n'), DefaultFileMode); err != nil {
+		return fmt.Errorf("failed to write manifest in %s: %w", dir, err)
+	}
+	logrus.Debugf("Wrote manifest with %d file(s) in %s", len(manifest.Files), dir)
+	return nil
+}
+
+// snapshotFile is a file of a project or backup, either stored as a plain file or in the object store.
+type snapshotFile struct {
+	// Source is the file to read the contents from.
+	Source string
+	// Path is relative to the requested directory of the snapshot.
+	Path string
+	// Hash is the object name when known from a manifest.
+	Hash string
+	// ModTime is the modification time recorded in a manifest, zero for plain files.
+	ModTime time.Time
+}
+
+// listSnapshotFiles lists the files of snapshotDir below subPath. Snapshots with a manifest are resolved to
+// their objects, anything else is read from disk.
+func listSnapshotFiles(vaultDir, snapshotDir, subPath string) ([]snapshotFile, error) {
+	manifest, ok, err := ReadManifest(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		dir := filepath.Join(snapshotDir, subPath)
+		if subPath != "" {
+			// A subdirectory missing from an existing snapshot has no files, like one missing from a manifest.
+			if _, err := os.Stat(snapshotDir); err == nil {
+				if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+					logrus.Debugf("No %s in %s", subPath, snapshotDir)
+					return nil, nil
+				}
+			}
+		}
+		files, err := utils.ReadDirRecursiveFunc(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshotFiles := make([]snapshotFile, 0, len(files))
+		for _, file := range files {
+			relativePath, err := filepath.Rel(dir, file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compute relative path: %w", err)
+			}
+			snapshotFiles = append(snapshotFiles, snapshotFile{Source: file, Path: relativePath})
+		}
+		return snapshotFiles, nil
+	}
+
+	prefix := filepath.ToSlash(filepath.Clean(subPath)) + "/"
+	if prefix == "./" {
+		prefix = ""
+	}
+
+	var snapshotFiles []snapshotFile
+	for _, entry := range manifest.Files {
+		if !strings.HasPrefix(entry.Path, prefix) {
+			continue
+		}
+		snapshotFiles = append(snapshotFiles, snapshotFile{
+			Source:  ObjectPath(vaultDir, entry.Hash),
+			Path:    filepath.FromSlash(strings.TrimPrefix(entry.Path, prefix)),
+			Hash:    entry.Hash,
+			ModTime: entry.ModTime,
+		})
+	}
+	logrus.Debugf("Resolved %d file(s) from manifest in %s", len(snapshotFiles), snapshotDir)
+	return snapshotFiles, nil
+}
+
+// DedupeSnapshot moves the plain files of a project or backup into the object store and replaces them
+// with a manifest. Directories that already have a manifest are left alone.
+func DedupeSnapshot(vaultDir, snapshotDir string, keys *Keys) (int, error) {
+	if _, ok, err := ReadManifest(snapshotDir); err != nil || ok {
+		return 0, err
+	}
+
+	files, err := listSnapshotFiles(vaultDir, snapshotDir, "")
+	if err != nil {
+		return 0, err
+	}
+
+	manifest := Manifest{}
+	for _, file := range files {
+		entry, err := StoreObject(vaultDir, file.Source, keys)
+		if err != nil {
+			return 0, err
+		}
+		entry.Path = filepath.ToSlash(file.Path)
+		manifest.Files = append(manifest.Files, entry)
+	}
+	if err := WriteManifest(snapshotDir, manifest); err != nil {
+		return 0, err
+	}
+
+	// Only remove the plain files once every object and the manifest are safely written.
+	for _, file := range files {
+		if err := os.Remove(file.Source); err != nil {
+			return 0, fmt.Errorf("failed to remove %s: %w", file.Source, err)
+		}
+	}
+	removeEmptyDirs(snapshotDir)
+
+	logrus.Debugf("Deduplicated %d file(s) in %s", len(files), snapshotDir)
+	return len(files), nil
+}
+
+// removeEmptyDirs removes empty directories below root, deepest first.
+func removeEmptyDirs(root string) {
+	var dirs []string
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		// Remove fails on purpose for directories that still have files.
+		_ = os.Remove(dirs[i])
+	}
+}
+
+// walkManifests calls fn for every manifest of the vault with the snapshot directory holding it.
+func walkManifests(vaultDir string, fn func(dir string, manifest Manifest) error) error {
+	return filepath.WalkDir(vaultDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ObjectsDirName {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || d.Name() != ManifestFileName {
+			return nil
+		}
+
+		manifest, ok, err := ReadManifest(filepath.Dir(path))
+		if err != nil || !ok {
+			return err
+		}
+		return fn(filepath.Dir(path), manifest)
+	})
+}
+
+// renameObjects renames every object referenced by a manifest after its objectName for keys and updates the
+// manifests, e.g. once a vault was encrypted or decrypted. Objects are linked under their new name before any
+// manifest is rewritten and only removed under their old name at the end, so that an interrupted rename leaves
+// every manifest readable.
+func renameObjects(vaultDir string, keys *Keys) error {
+	renamed := map[string]string{}
+	err := walkManifests(vaultDir, func(dir string, manifest Manifest) error {
+		changed := false
+		for i, entry := range manifest.Files {
+			name, ok := renamed[entry.Hash]
+			if !ok {
+				data, err := ReadVaultFile(ObjectPath(vaultDir, entry.Hash), keys)
+				if err != nil {
+					return err
+				}
+				if name, err = keys.objectName(data); err != nil {
+					return err
+				}
+				if err := linkObject(vaultDir, entry.Hash, name); err != nil {
+					return err
+				}
+				renamed[entry.Hash] = name
+			}
+			if name != entry.Hash {
+				manifest.Files[i].Hash = name
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		return WriteManifest(dir, manifest)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename objects: %w", err)
+	}
+
+	for from, to := range renamed {
+		if from == to {
+			continue
+		}
+		if err := os.Remove(ObjectPath(vaultDir, from)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove object %s: %w", from, err)
+		}
+		logrus.Debugf("Renamed object %s to %s", from, to)
+	}
+	removeEmptyDirs(filepath.Join(vaultDir, ObjectsDirName))
+	return nil
+}
+
+// linkObject makes the object from also available as to, unless an object named to is already stored.
+func linkObject(vaultDir, from, to string) error {
+	target := ObjectPath(vaultDir, to)
+	if _, err := os.Stat(target); from == to || err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), VaultDirMode); err != nil {
+		return fmt.Errorf("failed to create object directory: %w", err)
+	}
+	if err := os.Link(ObjectPath(vaultDir, from), target); err == nil {
+		return nil
+	}
+
+	// Some file systems have no hard links, so the object is copied instead.
+	data, err := os.ReadFile(ObjectPath(vaultDir, from))
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", from, err)
+	}
+	if err := utils.WriteFileAtomic(target, data, DefaultFileMode); err != nil {
+		return fmt.Errorf("failed to store object %s: %w", to, err)
+	}
+	return nil
+}
+
+// CollectGarbage removes objects that are no longer referenced by any manifest in the vault.
+func CollectGarbage(vaultDir string) (int, error) {
+	referenced := map[string]bool{}
+	err := walkManifests(vaultDir, func(dir string, manifest Manifest) error {
+		for _, entry := range manifest.Files {
+			referenced[entry.Hash] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to collect referenced objects: %w", err)
+	}
+
+	objectsDir := filepath.Join(vaultDir, ObjectsDirName)
+	removed := 0
+	err = filepath.WalkDir(objectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		hash := filepath.Base(filepath.Dir(path)) + d.Name()
+		if referenced[hash] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		logrus.Debugf("Removed unreferenced object: %s", hash)
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to remove unreferenced objects: %w", err)
+	}
+	removeEmptyDirs(objectsDir)
+	return removed, nil
+}
+
+// DedupeResult is the outcome of deduplicating one project or backup.
+type DedupeResult struct {
+	Dir   string
+	Files int
+}
+
+// DedupeVault converts every plain project and backup of the vault, or only the given project and its
+// backups, into manifests backed by the object store. Once ctx is canceled, the remaining projects and
+// backups are left alone; each one is converted as a whole or not at all.
+func DedupeVault(ctx context.Context, vaultDir, project string, keys *Keys) ([]DedupeResult, error) {
+	var dirs []string
+	if project != "" {
+		dirs = append(dirs, filepath.Join(vaultDir, project))
+	} else {
+		projects, err := GetProjectsList(vaultDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range projects {
+			dirs = append(dirs, filepath.Join(vaultDir, p.Name))
+		}
+	}
+
+	backups, err := ListBackups(vaultDir)
+	if err != nil {
+		return nil, err
+	}
+	if project != "" {
+		backups = FilterBackups(backups, project)
+	}
+	for _, backup := range backups {
+		dirs = append(dirs, filepath.Join(vaultDir, backup.Name))
+	}
+
+	var results []DedupeResult
+	for _, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("dedupe interrupted: %w", err)
+		}
+		files, err := DedupeSnapshot(vaultDir, dir, keys)
+		if err != nil {
+			return results, err
+		}
+		if files > 0 {
+			results = append(results, DedupeResult{Dir: dir, Files: files})
+		}
+	}
+	return results, nil
+}
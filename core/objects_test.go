@@ -0,0 +1,201 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+func TestStoreObject(t *testing.T) {
+	vaultDir := t.TempDir()
+	source := filepath.Join(t.TempDir(), ".env")
+	assert.NoError(t, os.WriteFile(source, []byte("hello"), 0600))
+
+	entry, err := StoreObject(vaultDir, source, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", entry.Hash)
+	assert.Equal(t, os.FileMode(0600), entry.Mode)
+	assert.Equal(t, filepath.Join(vaultDir, ".objects", "2c", "f24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"), ObjectPath(vaultDir, entry.Hash))
+
+	stored, err := os.ReadFile(ObjectPath(vaultDir, entry.Hash))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(stored))
+
+	// Storing the same contents again reuses the object.
+	assert.NoError(t, os.WriteFile(ObjectPath(vaultDir, entry.Hash), []byte("existing"), 0644))
+	again, err := StoreObject(vaultDir, source, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, entry.Hash, again.Hash)
+	stored, err = os.ReadFile(ObjectPath(vaultDir, entry.Hash))
+	assert.NoError(t, err)
+	assert.Equal(t, "existing", string(stored), "Expected an existing object not to be written again")
+
+	_, err = StoreObject(vaultDir, filepath.Join(t.TempDir(), "missing"), nil)
+	assert.Error(t, err)
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshot")
+
+	_, ok, err := ReadManifest(dir)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, WriteManifest(dir, Manifest{Files: []ManifestEntry{
+		{Path: "b/.env", Hash: strings.Repeat("b", 64), Mode: 0600},
+		{Path: ".env", Hash: strings.Repeat("a", 64), Mode: 0644},
+	}}))
+
+	manifest, ok, err := ReadManifest(dir)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, manifest.Version)
+	assert.Equal(t, ".env", manifest.Files[0].Path, "Expected files to be sorted by path")
+	assert.Equal(t, os.FileMode(0600), manifest.Files[1].Mode)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ManifestFileName), []byte(`{"version": 99, "files": []}`), 0644))
+	_, _, err = ReadManifest(dir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported manifest version")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ManifestFileName), []byte(`not json`), 0644))
+	_, _, err = ReadManifest(dir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse manifest")
+}
+
+func TestReadManifest_Corrupt(t *testing.T) {
+	hash := strings.Repeat("a", 64)
+	for name, entry := range map[string]string{
+		"empty hash":     `{"path": ".env", "hash": ""}`,
+		"short hash":     `{"path": ".env", "hash": "a"}`,
+		"uppercase hash": `{"path": ".env", "hash": "` + strings.ToUpper(hash) + `"}`,
+		"parent path":    `{"path": "../../.ssh/x", "hash": "` + hash + `"}`,
+		"hidden parent":  `{"path": "apps/../../x", "hash": "` + hash + `"}`,
+		"absolute path":  `{"path": "/etc/passwd", "hash": "` + hash + `"}`,
+		"backslash path": `{"path": "..\\x", "hash": "` + hash + `"}`,
+		"empty path":     `{"path": "", "hash": "` + hash + `"}`,
+	} {
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, ManifestFileName), []byte(`{"version": 1, "files": [`+entry+`]}`), 0644))
+
+		_, _, err := ReadManifest(dir)
+		assert.ErrorContains(t, err, "corrupt manifest", name)
+		assert.NotPanics(t, func() { _, _ = listSnapshotFiles(t.TempDir(), dir, "") }, name)
+	}
+}
+
+func TestDedupeSnapshot(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env", "apps/api/.env")
+	writeBackup(t, vaultDir, "api", ".env")
+
+	files, err := DedupeSnapshot(vaultDir, filepath.Join(vaultDir, "web"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, files)
+	files, err = DedupeSnapshot(vaultDir, filepath.Join(vaultDir, "api"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, files)
+
+	// Every file had the same contents, so only one object is stored.
+	objects, err := utils.ReadDirRecursive(filepath.Join(vaultDir, ObjectsDirName))
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+
+	entries, err := os.ReadDir(filepath.Join(vaultDir, "web"))
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1, "Expected only the manifest to be left") {
+		assert.Equal(t, ManifestFileName, entries[0].Name())
+	}
+
+	snapshotFiles, err := listSnapshotFiles(vaultDir, filepath.Join(vaultDir, "web"), "apps")
+	assert.NoError(t, err)
+	if assert.Len(t, snapshotFiles, 1) {
+		assert.Equal(t, filepath.Join("api", ".env"), snapshotFiles[0].Path)
+		assert.Equal(t, objects[0], snapshotFiles[0].Source)
+	}
+
+	files, err = DedupeSnapshot(vaultDir, filepath.Join(vaultDir, "web"), nil)
+	assert.NoError(t, err)
+	assert.Zero(t, files, "Expected a deduplicated snapshot to be left alone")
+}
+
+func TestDedupeVault(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env")
+	writeBackup(t, vaultDir, "api", ".env")
+	writeBackup(t, vaultDir, ".backups/web/2024-05-01_10-00-00", ".env")
+
+	results, err := DedupeVault(context.Background(), vaultDir, "web", nil)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.NoFileExists(t, filepath.Join(vaultDir, ".backups", "web", "2024-05-01_10-00-00", ".env"))
+	assert.FileExists(t, filepath.Join(vaultDir, "api", ".env"), "Expected other projects to be untouched")
+
+	results, err = DedupeVault(context.Background(), vaultDir, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []DedupeResult{{Dir: filepath.Join(vaultDir, "api"), Files: 1}}, results)
+}
+
+func TestCollectGarbage(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env")
+	_, err := DedupeSnapshot(vaultDir, filepath.Join(vaultDir, "web"), nil)
+	assert.NoError(t, err)
+
+	orphan := filepath.Join(t.TempDir(), "orphan.env")
+	assert.NoError(t, os.WriteFile(orphan, []byte("ORPHAN=1\n"), 0644))
+	orphanEntry, err := StoreObject(vaultDir, orphan, nil)
+	assert.NoError(t, err)
+
+	removed, err := CollectGarbage(vaultDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.NoFileExists(t, ObjectPath(vaultDir, orphanEntry.Hash))
+	assert.NoDirExists(t, filepath.Dir(ObjectPath(vaultDir, orphanEntry.Hash)))
+
+	files, err := listSnapshotFiles(vaultDir, filepath.Join(vaultDir, "web"), "")
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.FileExists(t, files[0].Source, "Expected referenced objects to be kept")
+	}
+
+	removed, err = CollectGarbage(t.TempDir())
+	assert.NoError(t, err, "Expected a vault without objects to have nothing to collect")
+	assert.Zero(t, removed)
+}
+
+func TestCopyEnvFilesToProject_FromManifest(t *testing.T) {
+	vaultDir := t.TempDir()
+	source := filepath.Join(vaultDir, "web", "apps", "api", ".env")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(source), 0755))
+	assert.NoError(t, os.WriteFile(source, []byte("KEY=value\n"), 0644))
+	_, err := DedupeSnapshot(vaultDir, filepath.Join(vaultDir, "web"), nil)
+	assert.NoError(t, err)
+
+	tempCwd := t.TempDir()
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	_, err = CopyEnvFilesToProject(context.Background(), CopyOptions{Project: "web", VaultDir: vaultDir})
+	assert.NoError(t, err)
+	copied, err := os.ReadFile(filepath.Join(tempCwd, "apps", "api", ".env"))
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY=value\n", string(copied))
+
+	diffs, err := DiffProject(CopyOptions{Project: "web", VaultDir: vaultDir, CurrentPath: "apps"})
+	assert.NoError(t, err)
+	if assert.Len(t, diffs, 1) {
+		assert.Equal(t, filepath.Join("api", ".env"), diffs[0].Path)
+		assert.Empty(t, diffs[0].Changes)
+	}
+}
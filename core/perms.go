@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+const (
+	// DefaultFileMode is the mode of env files written by cpenv unless file_mode is configured.
+	// Files inside the vault always use it.
+	DefaultFileMode fs.FileMode = 0600
+	// VaultDirMode is the mode of directories created in the vault.
+	VaultDirMode fs.FileMode = 0700
+)
+
+// ParseFileMode parses the file_mode config value. YAML reads an unquoted 0600 as the octal number
+// already, while strings such as "0600" or "600" are parsed as octal.
+func ParseFileMode(value interface{}) (fs.FileMode, error) {
+	var mode uint64
+	switch v := value.(type) {
+	case nil:
+		return DefaultFileMode, nil
+	case int:
+		mode = uint64(v)
+	case int64:
+		mode = uint64(v)
+	case uint64:
+		mode = v
+	case string:
+		s := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(v), "0o"), "0O")
+		if s == "" {
+			return DefaultFileMode, nil
+		}
+		parsed, err := strconv.ParseUint(s, 8, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid file mode %q (expected an octal mode such as 0600)", v)
+		}
+		mode = parsed
+	default:
+		return 0, fmt.Errorf("invalid file mode %v (expected an octal mode such as 0600)", value)
+	}
+
+	if mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %o (expected an octal mode such as 0600)", mode)
+	}
+	if mode&0400 == 0 {
+		return 0, fmt.Errorf("invalid file mode %04o (the owner must be able to read env files)", mode)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// PermissionFix is a file or directory of the vault whose mode is changed.
+type PermissionFix struct {
+	Path string
+	From fs.FileMode
+	To   fs.FileMode
+}
+
+// PlanFixPermissions lists the files and directories of the vault that are accessible to other users than
+// the owner, and clears just their group and other bits; modes that are already stricter are left alone.
+// A .git folder is skipped, so that a vault kept in git keeps its executable hooks.
+func PlanFixPermissions(vaultDir string) ([]PermissionFix, error) {
+	var fixes []PermissionFix
+	err := filepath.WalkDir(vaultDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if mode := info.Mode().Perm(); mode&0o077 != 0 {
+			fixes = append(fixes, PermissionFix{Path: path, From: mode, To: mode &^ 0o077})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault permissions: %w", err)
+	}
+	return fixes, nil
+}
+
+// FixPermissions applies the planned modes. Once ctx is canceled, the remaining modes are left alone.
+func FixPermissions(ctx context.Context, fixes []PermissionFix) error {
+	for _, fix := range fixes {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("fixing permissions interrupted: %w", err)
+		}
+		if err := os.Chmod(fix.Path, fix.To); err != nil {
+			return fmt.Errorf("failed to change mode of %s: %w", fix.Path, err)
+		}
+		logrus.Debugf("Changed mode of %s from %04o to %04o", fix.Path, fix.From, fix.To)
+	}
+	return nil
+}
+
+// PrintPermissionFixes lists the planned or applied mode changes.
+func PrintPermissionFixes(w io.Writer, fixes []PermissionFix, vaultDir string, dryRun bool) {
+	if len(fixes) == 0 {
+		fmt.Fprintf(w, "%s %s\n", utils.SuccessIcon(), utils.WhiteText("Vault permissions are already secure."))
+		return
+	}
+	if dryRun {
+		fmt.Fprintf(w, "%s %s\n", utils.InfoIcon(), utils.WhiteText("Dry run, no permissions will be changed:"))
+	}
+
+	for _, fix := range fixes {
+		fmt.Fprintf(w, "  %04o -> %04o %s\n", fix.From, fix.To, utils.CyanText(prettifiedPath(fix.Path, vaultDir)))
+	}
+
+	verb := "fixed"
+	if dryRun {
+		verb = "to fix"
+	}
+	fmt.Fprintf(w, "\n%d %s\n", len(fixes), verb)
+}
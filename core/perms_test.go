@@ -0,0 +1,128 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    os.FileMode
+		wantErr bool
+	}{
+		{value: nil, want: 0600},
+		{value: "", want: 0600},
+		{value: "0640", want: 0640},
+		{value: "600", want: 0600},
+		{value: "0o644", want: 0644},
+		// YAML reads an unquoted 0600 as an octal number.
+		{value: 384, want: 0600},
+		{value: "0800", wantErr: true},
+		{value: "01777", wantErr: true},
+		{value: "0200", wantErr: true},
+		{value: 1.5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		mode, err := ParseFileMode(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, tt.value)
+			continue
+		}
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.want, mode, tt.value)
+	}
+}
+
+func TestFixPermissions(t *testing.T) {
+	vaultDir := t.TempDir()
+	assert.NoError(t, os.Chmod(vaultDir, 0755))
+	writeBackup(t, vaultDir, "web", ".env")
+	assert.NoError(t, os.Chmod(filepath.Join(vaultDir, "web", ".env"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(vaultDir, "api.env"), []byte("KEY=value\n"), 0600))
+	assert.NoError(t, os.Chmod(filepath.Join(vaultDir, "api.env"), 0600))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(vaultDir, "readonly.env"), []byte("KEY=value\n"), 0400))
+	assert.NoError(t, os.Chmod(filepath.Join(vaultDir, "readonly.env"), 0400))
+	hook := filepath.Join(vaultDir, ".git", "hooks", "pre-commit")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(hook), 0755))
+	assert.NoError(t, os.WriteFile(hook, []byte("#!/bin/sh\n"), 0755))
+	assert.NoError(t, os.Chmod(hook, 0755))
+
+	fixes, err := PlanFixPermissions(vaultDir)
+	assert.NoError(t, err)
+	assert.Len(t, fixes, 3, "Expected the vault, the project folder and the world-readable file to be fixed")
+
+	var buf bytes.Buffer
+	PrintPermissionFixes(&buf, fixes, vaultDir, true)
+	assert.Contains(t, buf.String(), "0644 -> 0600 {vault}/web/.env")
+	assert.Contains(t, buf.String(), "3 to fix")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, FixPermissions(ctx, fixes), context.Canceled)
+	info, err := os.Stat(vaultDir)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm(), "Expected nothing to change once interrupted")
+
+	assert.NoError(t, FixPermissions(context.Background(), fixes))
+	info, err = os.Stat(filepath.Join(vaultDir, "web"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(vaultDir, "web", ".env"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	info, err = os.Stat(filepath.Join(vaultDir, "readonly.env"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0400), info.Mode().Perm(), "Expected stricter modes to be kept")
+	info, err = os.Stat(hook)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm(), "Expected git hooks to be left alone")
+
+	fixes, err = PlanFixPermissions(vaultDir)
+	assert.NoError(t, err)
+	assert.Empty(t, fixes)
+	buf.Reset()
+	PrintPermissionFixes(&buf, fixes, vaultDir, false)
+	assert.Contains(t, buf.String(), "already secure")
+}
+
+func TestCopyEnvFilesToProject_FileMode(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env", "apps/api/.env")
+
+	tempCwd := t.TempDir()
+	origWd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	// An existing world-readable file is tightened when it is overwritten.
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, ".env"), []byte("OLD=1\n"), 0644))
+	assert.NoError(t, os.Chmod(filepath.Join(tempCwd, ".env"), 0644))
+
+	_, err = CopyEnvFilesToProject(context.Background(), CopyOptions{Project: "web", VaultDir: vaultDir, Overwrite: OverwriteAlways})
+	assert.NoError(t, err)
+	for _, file := range []string{".env", filepath.Join("apps", "api", ".env")} {
+		info, err := os.Stat(filepath.Join(tempCwd, file))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), file)
+	}
+
+	// Unchanged files are left alone, so only the recreated file gets the configured mode.
+	assert.NoError(t, os.Remove(filepath.Join(tempCwd, ".env")))
+	_, err = CopyEnvFilesToProject(context.Background(), CopyOptions{Project: "web", VaultDir: vaultDir, Overwrite: OverwriteAlways, FileMode: 0640})
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(tempCwd, ".env"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
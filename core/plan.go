@@ -0,0 +1,87 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// PlanAction is what a copy or backup will do with a single file.
+type PlanAction string
+
+const (
+	ActionCreate    PlanAction = "create"
+	ActionOverwrite PlanAction = "overwrite"
+	ActionSkip      PlanAction = "skip"
+	ActionIdentical PlanAction = "identical"
+	// ActionMerge merges the keys of the source into the existing destination.
+	ActionMerge PlanAction = "merge"
+	// ActionPrompt is used when the user will be asked before overwriting.
+	ActionPrompt PlanAction = "prompt"
+	// ActionError is used when the file could not be planned, see PlanEntry.Error.
+	ActionError PlanAction = "error"
+)
+
+type PlanEntry struct {
+	Source string `json:"source"`
+	// Overlay is the profile file layered on Source, its keys winning over those of Source.
+	Overlay     string     `json:"overlay,omitempty"`
+	Destination string     `json:"destination"`
+	Action      PlanAction `json:"action"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Plan is the full list of file operations computed before anything touches disk.
+type Plan struct {
+	// Destination is the directory the entries are written into.
+	Destination string      `json:"destination"`
+	Entries     []PlanEntry `json:"entries"`
+}
+
+// Count returns how many entries of the plan will perform the given action.
+func (p Plan) Count(action PlanAction) int {
+	count := 0
+	for _, entry := range p.Entries {
+		if entry.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+func PrintPlan(w io.Writer, plan Plan, vaultDir string, asJSON bool) error {
+	if asJSON {
+		if plan.Entries == nil {
+			plan.Entries = []PlanEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(plan); err != nil {
+			return fmt.Errorf("failed to encode plan: %w", err)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(w, "%s %s\n", utils.InfoIcon(), utils.WhiteText("Dry run, no files will be written:"))
+	if len(plan.Entries) == 0 {
+		fmt.Fprintf(w, "%s %s\n", utils.WarningIcon(), utils.WhiteText("No env files found."))
+		return nil
+	}
+
+	for _, entry := range plan.Entries {
+		if entry.Action == ActionError {
+			fmt.Fprintf(w, "  %s %s: %s\n", utils.RedText(fmt.Sprintf("%-9s", entry.Action)), utils.CyanText(prettifiedPath(entry.Source, vaultDir)), entry.Error)
+			continue
+		}
+		fmt.Fprintf(w, "  %-9s %s %s %s\n", entry.Action, utils.CyanText(sourceLabel(entry.Source, entry.Overlay, vaultDir)), utils.WhiteText("->"), utils.CyanText(prettifiedPath(entry.Destination, vaultDir)))
+	}
+
+	fmt.Fprintf(w, "\n%d to create, %d to overwrite, %d to merge, %d to prompt, %d to skip, %d identical\n",
+		plan.Count(ActionCreate), plan.Count(ActionOverwrite), plan.Count(ActionMerge), plan.Count(ActionPrompt), plan.Count(ActionSkip), plan.Count(ActionIdentical))
+	if errors := plan.Count(ActionError); errors > 0 {
+		fmt.Fprintf(w, "%d could not be planned\n", errors)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanCount(t *testing.T) {
+	plan := Plan{Entries: []PlanEntry{
+		{Action: ActionCreate},
+		{Action: ActionCreate},
+		{Action: ActionSkip},
+	}}
+	assert.Equal(t, 2, plan.Count(ActionCreate))
+	assert.Equal(t, 1, plan.Count(ActionSkip))
+	assert.Equal(t, 0, plan.Count(ActionOverwrite))
+}
+
+func TestPrintPlan_JSON(t *testing.T) {
+	plan := Plan{
+		Destination: "/tmp/project",
+		Entries: []PlanEntry{
+			{Source: "/vault/app/.env", Destination: "/tmp/project/.env", Action: ActionOverwrite},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, PrintPlan(&buf, plan, "/vault", true))
+
+	var decoded Plan
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, plan, decoded)
+	assert.Contains(t, buf.String(), `"action": "overwrite"`)
+}
+
+func TestPrintPlan_JSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, PrintPlan(&buf, Plan{}, "/vault", true))
+	assert.Contains(t, buf.String(), `"entries": []`)
+}
+
+func TestPrintPlan_Text(t *testing.T) {
+	plan := Plan{Entries: []PlanEntry{
+		{Source: "/elsewhere/a.env", Destination: "/elsewhere/b.env", Action: ActionCreate},
+		{Source: "/elsewhere/c.env", Destination: "/elsewhere/d.env", Action: ActionIdentical},
+	}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, PrintPlan(&buf, plan, "/vault", false))
+	out := buf.String()
+	assert.Contains(t, out, "Dry run")
+	assert.Contains(t, out, "create")
+	assert.Contains(t, out, "/elsewhere/a.env")
+	assert.Contains(t, out, "1 to create, 0 to overwrite, 0 to merge, 0 to prompt, 0 to skip, 1 identical")
+}
+
+func TestPrintPlan_Errors(t *testing.T) {
+	plan := Plan{Entries: []PlanEntry{
+		{Source: "/elsewhere/a.env", Destination: "/elsewhere/b.env", Action: ActionError, Error: "failed to decrypt"},
+	}}
+
+	var buf bytes.Buffer
+	assert.NoError(t, PrintPlan(&buf, plan, "/vault", false))
+	assert.Contains(t, buf.String(), "/elsewhere/a.env: failed to decrypt")
+	assert.Contains(t, buf.String(), "1 could not be planned")
+}
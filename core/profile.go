@@ -0,0 +1,222 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/dotenv"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// ProfilePrefix marks the top-level folders of a project holding a profile, e.g. {vault}/web/@staging. The files
+// of a profile are layered on the files of the project at the same path, the profile winning for every key.
+const ProfilePrefix = "@"
+
+// baseProfileOption is the option of SelectProfile copying the base files without a profile.
+const baseProfileOption = "(base files only)"
+
+// Profile is a variant of a vault project.
+type Profile struct {
+	Name string
+	// Files are the slash-separated paths of the files of the profile, relative to the profile folder.
+	Files []string
+}
+
+// isProfilePath reports whether a path relative to the project is inside a profile folder.
+func isProfilePath(relativePath string) bool {
+	first, _, _ := strings.Cut(filepath.ToSlash(relativePath), "/")
+	return strings.HasPrefix(first, ProfilePrefix)
+}
+
+// ListProfiles returns the profiles of a project, sorted by name.
+func ListProfiles(vaultDir, project string) ([]Profile, error) {
+	files, err := listSnapshotFiles(vaultDir, filepath.Join(vaultDir, project), "")
+	if err != nil {
+		return nil, fmt.Errorf("error reading project %s: %w", project, err)
+	}
+
+	byName := map[string]*Profile{}
+	var profiles []*Profile
+	for _, file := range files {
+		first, rest, ok := strings.Cut(filepath.ToSlash(file.Path), "/")
+		if !ok || !strings.HasPrefix(first, ProfilePrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(first, ProfilePrefix)
+		profile, ok := byName[name]
+		if !ok {
+			profile = &Profile{Name: name}
+			byName[name] = profile
+			profiles = append(profiles, profile)
+		}
+		profile.Files = append(profile.Files, rest)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	result := make([]Profile, 0, len(profiles))
+	for _, profile := range profiles {
+		sort.Strings(profile.Files)
+		result = append(result, *profile)
+	}
+	logrus.Debugf("Found %d profile(s) in project %s", len(result), project)
+	return result, nil
+}
+
+// copySource is a file of the project to copy and the profile file layered on it, if any.
+type copySource struct {
+	snapshotFile
+	// Overlay is the profile file layered on Source, see PlanEntry.Overlay.
+	Overlay string
+}
+
+// listCopySources returns the files of the project below the current path of opts with the files of the
+// profile of opts layered on them. Files only in the profile are copied as they are.
+func listCopySources(opts CopyOptions) ([]copySource, error) {
+	projectDir := filepath.Join(opts.VaultDir, opts.Project)
+	files, err := listSnapshotFiles(opts.VaultDir, projectDir, opts.CurrentPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading project path: %w", err)
+	}
+
+	// Backups are snapshots of a working tree, so their folders starting with @ are copied like any other.
+	_, _, legacyBackup := ParseBackupName(opts.Project)
+	backup := legacyBackup || strings.HasPrefix(filepath.ToSlash(opts.Project), BackupsDirName+"/")
+
+	var sources []copySource
+	index := map[string]int{}
+	for _, file := range files {
+		// Profile folders are only at the top of the project, so they are never below a current path.
+		if !backup && opts.CurrentPath == "" && isProfilePath(file.Path) {
+			continue
+		}
+		index[file.Path] = len(sources)
+		sources = append(sources, copySource{snapshotFile: file})
+	}
+
+	profile := strings.TrimPrefix(opts.Profile, ProfilePrefix)
+	if profile == "" {
+		return sources, nil
+	}
+	if err := checkProfile(opts.VaultDir, opts.Project, profile); err != nil {
+		return nil, err
+	}
+
+	overlays, err := listSnapshotFiles(opts.VaultDir, projectDir, filepath.Join(ProfilePrefix+profile, opts.CurrentPath))
+	if err != nil {
+		return nil, fmt.Errorf("error reading profile %s: %w", profile, err)
+	}
+	for _, overlay := range overlays {
+		if i, ok := index[overlay.Path]; ok {
+			sources[i].Overlay = overlay.Source
+			continue
+		}
+		sources = append(sources, copySource{snapshotFile: overlay})
+	}
+	return sources, nil
+}
+
+// checkProfile returns an error naming the available profiles when the project has no such profile.
+func checkProfile(vaultDir, project, profile string) error {
+	profiles, err := ListProfiles(vaultDir, project)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		if p.Name == profile {
+			return nil
+		}
+		names = append(names, p.Name)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("profile %s not found, project %s has no profiles", profile, project)
+	}
+	return fmt.Errorf("profile %s not found in project %s (available: %s)", profile, project, strings.Join(names, ", "))
+}
+
+// readSource returns the plaintext of a vault file, with the profile file being copied layered on it.
+func (opts CopyOptions) readSource(sourcePath string) ([]byte, error) {
+	data, err := ReadVaultFile(sourcePath, opts.Keys)
+	if err != nil || opts.overlay == "" {
+		return data, err
+	}
+
+	overlayData, err := ReadVaultFile(opts.overlay, opts.Keys)
+	if err != nil {
+		return nil, err
+	}
+	base, err := dotenv.ParseString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot apply profile: failed to parse %s: %w", sourcePath, err)
+	}
+	overlay, err := dotenv.ParseString(string(overlayData))
+	if err != nil {
+		return nil, fmt.Errorf("cannot apply profile: failed to parse %s: %w", opts.overlay, err)
+	}
+	layered, err := dotenv.Merge(base, overlay, true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot apply profile %s: %w", opts.overlay, err)
+	}
+	return []byte(layered.String()), nil
+}
+
+// sourceLabel returns the prettified source of a copy, followed by the profile file layered on it.
+func sourceLabel(sourcePath, overlay, vaultDir string) string {
+	if overlay == "" {
+		return prettifiedPath(sourcePath, vaultDir)
+	}
+	return prettifiedPath(sourcePath, vaultDir) + " + " + prettifiedPath(overlay, vaultDir)
+}
+
+// SelectProfile asks the user to pick a profile to layer on the base files, after the project was picked.
+// It returns an empty name when the base files are copied without a profile.
+func SelectProfile(profiles []Profile) (string, error) {
+	items := []string{baseProfileOption}
+	for _, profile := range profiles {
+		items = append(items, profile.Name)
+	}
+
+	prompt := promptui.Select{
+		Label: "Choose a profile to layer on the base files",
+		Items: items,
+	}
+
+	_, selected, err := selectProjectRun(prompt)
+	if err != nil {
+		if err == promptui.ErrInterrupt {
+			logrus.Debug("User aborted profile selection")
+			fmt.Printf("%s %s\n", utils.WarningIcon(), utils.WhiteText("Selection cancelled."))
+			exitFunc(0)
+		}
+		return "", fmt.Errorf("error starting the selection form: %w", err)
+	}
+
+	if selected == baseProfileOption {
+		return "", nil
+	}
+	logrus.Debugf("Profile selected: %s", selected)
+	return selected, nil
+}
+
+// PrintProfiles lists the profiles of a project with their files.
+func PrintProfiles(w io.Writer, project string, profiles []Profile) {
+	if len(profiles) == 0 {
+		fmt.Fprintf(w, "%s %s %s\n", utils.WarningIcon(), utils.WhiteText("No profiles found in project"), utils.CyanText(project))
+		return
+	}
+
+	width := 0
+	for _, profile := range profiles {
+		width = max(width, len(profile.Name))
+	}
+	for _, profile := range profiles {
+		fmt.Fprintf(w, "  %s  %s\n", utils.CyanText(fmt.Sprintf("%-*s", width, profile.Name)), strings.Join(profile.Files, ", "))
+	}
+	fmt.Fprintf(w, "\n%d profile(s)\n", len(profiles))
+}
@@ -0,0 +1,188 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/manifoldco/promptui"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeProjectFiles writes files of a vault project, keyed by their slash-separated path.
+func writeProjectFiles(t *testing.T, vaultDir, project string, files map[string]string) {
+	t.Helper()
+	for file, content := range files {
+		path := filepath.Join(vaultDir, project, filepath.FromSlash(file))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestListProfiles(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeProjectFiles(t, vaultDir, "web", map[string]string{
+		".env":                   "A=1\n",
+		"@test/.env":             "A=3\n",
+		"@staging/.env":          "A=2\n",
+		"@staging/apps/web/.env": "B=2\n",
+	})
+
+	profiles, err := ListProfiles(vaultDir, "web")
+	assert.NoError(t, err)
+	assert.Equal(t, []Profile{
+		{Name: "staging", Files: []string{".env", "apps/web/.env"}},
+		{Name: "test", Files: []string{".env"}},
+	}, profiles)
+
+	var buf bytes.Buffer
+	PrintProfiles(&buf, "web", profiles)
+	assert.Contains(t, buf.String(), "apps/web/.env")
+	assert.Contains(t, buf.String(), "2 profile(s)")
+
+	writeProjectFiles(t, vaultDir, "api", map[string]string{".env": "A=1\n"})
+	profiles, err = ListProfiles(vaultDir, "api")
+	assert.NoError(t, err)
+	assert.Empty(t, profiles)
+
+	buf.Reset()
+	PrintProfiles(&buf, "api", profiles)
+	assert.Contains(t, buf.String(), "No profiles found in project")
+}
+
+func TestPlanCopyToProject_Profile(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeProjectFiles(t, vaultDir, "web", map[string]string{
+		".env":                "A=1\nB=1\n",
+		".env.local":          "C=1\n",
+		"@staging/.env":       "B=2\nD=2\n",
+		"@staging/.env.debug": "E=2\n",
+		"@test/.env":          "B=3\n",
+	})
+	root := t.TempDir()
+
+	plan, err := PlanCopyToProject(CopyOptions{Project: "web", VaultDir: vaultDir, Root: root})
+	assert.NoError(t, err)
+	assert.Len(t, plan.Entries, 2, "Expected profile folders to be left out of the base files")
+
+	plan, err = PlanCopyToProject(CopyOptions{Project: "web", VaultDir: vaultDir, Root: root, Profile: "@staging"})
+	assert.NoError(t, err)
+	overlays := map[string]string{}
+	for _, entry := range plan.Entries {
+		relativePath, err := filepath.Rel(root, entry.Destination)
+		assert.NoError(t, err)
+		overlays[filepath.ToSlash(relativePath)] = entry.Overlay
+	}
+	assert.Equal(t, map[string]string{
+		".env":       filepath.Join(vaultDir, "web", "@staging", ".env"),
+		".env.local": "",
+		".env.debug": "",
+	}, overlays)
+
+	_, err = PlanCopyToProject(CopyOptions{Project: "web", VaultDir: vaultDir, Root: root, Profile: "prod"})
+	assert.ErrorContains(t, err, "available: staging, test")
+}
+
+func TestCopyEnvFilesToProject_Profile(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeProjectFiles(t, vaultDir, "web", map[string]string{
+		".env":          "# shared\nA=1\nB=1\n",
+		"@staging/.env": "B=2\nD=2\n",
+	})
+	root := t.TempDir()
+	opts := CopyOptions{Project: "web", VaultDir: vaultDir, Root: root, Profile: "staging", Overwrite: OverwriteAlways}
+
+	results, err := CopyEnvFilesToProject(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, results.Count(StatusCreated))
+	data, err := os.ReadFile(filepath.Join(root, ".env"))
+	assert.NoError(t, err)
+	assert.Equal(t, "# shared\nA=1\nB=2\n\nD=2\n", string(data), "Expected the profile to win for every key")
+
+	plan, err := PlanCopyToProject(opts)
+	assert.NoError(t, err)
+	if assert.Len(t, plan.Entries, 1) {
+		assert.Equal(t, ActionIdentical, plan.Entries[0].Action, "Expected the layered file to be compared, not the base file")
+	}
+}
+
+func TestPlanCopyToProject_ProfileSubdirectory(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeProjectFiles(t, vaultDir, "web", map[string]string{
+		"apps/web/.env":          "A=1\n",
+		"@staging/.env":          "A=2\n",
+		"@staging/apps/web/.env": "A=3\n",
+	})
+	root := t.TempDir()
+
+	plan, err := PlanCopyToProject(CopyOptions{Project: "web", VaultDir: vaultDir, Root: root, CurrentPath: filepath.Join("apps", "web"), Profile: "staging"})
+	assert.NoError(t, err)
+	if assert.Len(t, plan.Entries, 1) {
+		assert.Equal(t, filepath.Join(root, "apps", "web", ".env"), plan.Entries[0].Destination)
+		assert.Equal(t, filepath.Join(vaultDir, "web", "@staging", "apps", "web", ".env"), plan.Entries[0].Overlay)
+	}
+}
+
+func TestPlanCopyToProject_BackupKeepsAtFolders(t *testing.T) {
+	vaultDir := t.TempDir()
+	backup := filepath.Join(BackupsDirName, "web", "2024-05-01_10-00-00")
+	writeProjectFiles(t, vaultDir, backup, map[string]string{"@scope/.env": "A=1\n"})
+
+	plan, err := PlanCopyToProject(CopyOptions{Project: backup, VaultDir: vaultDir, Root: t.TempDir()})
+	assert.NoError(t, err)
+	assert.Len(t, plan.Entries, 1, "Expected folders of a backup starting with @ to be restored")
+}
+
+func TestSelectProfile(t *testing.T) {
+	origSelectRun := selectProjectRun
+	defer func() { selectProjectRun = origSelectRun }()
+
+	var items interface{}
+	selectProjectRun = func(prompt promptui.Select) (int, string, error) {
+		items = prompt.Items
+		return 1, "staging", nil
+	}
+	selected, err := SelectProfile([]Profile{{Name: "staging"}, {Name: "test"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "staging", selected)
+	assert.Equal(t, []string{baseProfileOption, "staging", "test"}, items)
+
+	selectProjectRun = func(prompt promptui.Select) (int, string, error) {
+		return 0, baseProfileOption, nil
+	}
+	selected, err = SelectProfile([]Profile{{Name: "staging"}})
+	assert.NoError(t, err)
+	assert.Empty(t, selected, "Expected no profile when the base files are picked")
+}
+
+func TestDiffProject_Profile(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeProjectFiles(t, vaultDir, "web", map[string]string{
+		"apps/web/.env":          "A=1\nB=1\n",
+		"apps/api/.env":          "C=1\n",
+		"@staging/apps/web/.env": "B=2\n",
+	})
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "apps", "web"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "apps", "web", ".env"), []byte("A=1\nB=2\n"), 0644))
+
+	diffs, err := DiffProject(CopyOptions{Project: "web", VaultDir: vaultDir, Root: root, CurrentPath: filepath.Join("apps", "web"), Profile: "staging"})
+	assert.NoError(t, err)
+	if assert.Len(t, diffs, 1, "Expected only the current path to be compared") {
+		assert.Equal(t, filepath.Join(root, "apps", "web", ".env"), diffs[0].LocalPath)
+		assert.NoError(t, diffs[0].Err)
+		assert.Empty(t, diffs[0].Changes, "Expected the profile to be layered on the base file")
+	}
+
+	diffs, err = DiffProject(CopyOptions{Project: "web", VaultDir: vaultDir, Root: root})
+	assert.NoError(t, err)
+	byPath := map[string]FileDiff{}
+	for _, diff := range diffs {
+		byPath[filepath.ToSlash(diff.Path)] = diff
+	}
+	assert.Len(t, byPath, 2, "Expected the whole project without the profile folder")
+	assert.Equal(t, []KeyChange{{Key: "B", Kind: KeyChanged, VaultValue: "1", LocalValue: "2"}}, byPath["apps/web/.env"].Changes)
+	assert.True(t, byPath["apps/api/.env"].LocalMissing)
+}
@@ -2,7 +2,12 @@ package core
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -10,6 +15,7 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/dotenv"
 	"github.com/y3owk1n/cpenv/utils"
 
 	"github.com/briandowns/spinner"
@@ -20,11 +26,19 @@ func GetProjectsList(vaultDir string) ([]utils.Directory, error) {
 	logrus.Debugf("Entering GetProjectsList, function_type: %v", reflect.TypeOf(GetProjectsList))
 	logrus.Debugf("Vault directory details: %s", vaultDir)
 
-	directories, err := utils.GetDirectories(vaultDir)
+	all, err := utils.GetDirectories(vaultDir)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving directories: %w", err)
 	}
 
+	// Dot directories such as .backups hold cpenv's own data and are not projects.
+	var directories []utils.Directory
+	for _, directory := range all {
+		if !strings.HasPrefix(directory.Name, ".") {
+			directories = append(directories, directory)
+		}
+	}
+
 	if len(directories) == 0 {
 		return nil, fmt.Errorf("no projects found in the vault")
 	}
@@ -45,7 +59,9 @@ var selectProjectRun = func(prompt promptui.Select) (int, string, error) {
 	return prompt.Run()
 }
 
-func SelectProject(projects []utils.Directory) (string, error) {
+// SelectProject asks the user to pick a project. The cursor starts on preselect when it is one of the projects,
+// e.g. the project detected from the git repository.
+func SelectProject(projects []utils.Directory, preselect string) (string, error) {
 	if len(projects) == 0 {
 		return "", fmt.Errorf("no projects found in the vault")
 	}
@@ -54,6 +70,13 @@ func SelectProject(projects []utils.Directory) (string, error) {
 		Label: "Choose a project to copy from",
 		Items: generateProjectOptions(projects),
 	}
+	for i, project := range projects {
+		if preselect != "" && project.Name == preselect {
+			logrus.Debugf("Preselecting project: %s", preselect)
+			prompt.CursorPos = i
+			break
+		}
+	}
 
 	_, selectedProject, err := selectProjectRun(prompt)
 	if err != nil {
@@ -82,45 +105,280 @@ func generateProjectOptions(projects []utils.Directory) []string {
 	return projectOptions
 }
 
-func CopyEnvFilesToProject(project string, currentPath string, vaultDir string) error {
-	logrus.Debugf("Vault directory details: vault_dir: %s, project: %s, current_path: %s", vaultDir, project, currentPath)
+// OverwriteMode controls what happens when a file already exists at the destination.
+type OverwriteMode string
+
+const (
+	OverwritePrompt OverwriteMode = "prompt"
+	OverwriteAlways OverwriteMode = "always"
+	OverwriteNever  OverwriteMode = "never"
+	// OverwriteMerge merges the keys of the vault file into the existing file.
+	OverwriteMerge OverwriteMode = "merge"
+)
+
+func ParseOverwriteMode(mode string) (OverwriteMode, error) {
+	switch m := OverwriteMode(strings.ToLower(strings.TrimSpace(mode))); m {
+	case OverwritePrompt, OverwriteAlways, OverwriteNever, OverwriteMerge:
+		return m, nil
+	case "":
+		return OverwritePrompt, nil
+	default:
+		return "", fmt.Errorf("invalid overwrite mode %q (expected always, never, merge or prompt)", mode)
+	}
+}
+
+// MergePreference decides which value wins for keys that exist on both sides of a merge.
+type MergePreference string
+
+const (
+	PreferVault MergePreference = "vault"
+	PreferLocal MergePreference = "local"
+)
+
+func ParseMergePreference(prefer string) (MergePreference, error) {
+	switch p := MergePreference(strings.ToLower(strings.TrimSpace(prefer))); p {
+	case PreferVault, PreferLocal:
+		return p, nil
+	case "":
+		return PreferVault, nil
+	default:
+		return "", fmt.Errorf("invalid merge preference %q (expected vault or local)", prefer)
+	}
+}
+
+// CopyOptions describes a copy from a vault project into a working tree.
+type CopyOptions struct {
+	Project string
+	// CurrentPath is the subdirectory of the project to copy, relative to both the project and Root.
+	CurrentPath string
+	// Root is the directory the files are copied into, usually the root of the repository. It defaults to
+	// the current working directory.
+	Root      string
+	VaultDir  string
+	Overwrite OverwriteMode
+	// Prefer is used when merging files and defaults to PreferVault.
+	Prefer MergePreference
+	// Input is where answers are read from when Overwrite is OverwritePrompt.
+	// It defaults to os.Stdin.
+	Input io.Reader
+	// Keys decrypt the files of an encrypted vault.
+	Keys *Keys
+	// FileMode is the mode of the copied env files and defaults to DefaultFileMode.
+	FileMode fs.FileMode
+	// Journal keeps the files that are overwritten so that the copy can be undone. It is optional.
+	Journal *Journal
+	// Files limits the copy to the files matching their paths, relative to the destination root, and may set
+	// the overwrite mode of each. Every file is copied when it is empty.
+	Files []ProjectFile
+	// Profile is layered on the files of the project, see ProfilePrefix. Only the base files are copied when
+	// it is empty.
+	Profile string
+
+	// overlay is the profile file layered on the file being copied.
+	overlay string
+}
+
+func (opts CopyOptions) withDefaults() CopyOptions {
+	if opts.Overwrite == "" {
+		opts.Overwrite = OverwritePrompt
+	}
+	if opts.Prefer == "" {
+		opts.Prefer = PreferVault
+	}
+	if opts.FileMode == 0 {
+		opts.FileMode = DefaultFileMode
+	}
+	if opts.Input == nil {
+		opts.Input = os.Stdin
+	}
+	// Share a single buffered reader across prompts so that read-ahead is not lost between files.
+	if _, ok := opts.Input.(*bufio.Reader); !ok {
+		opts.Input = bufio.NewReader(opts.Input)
+	}
+	return opts
+}
+
+// root returns the directory the files are copied into.
+func (opts CopyOptions) root() string {
+	if opts.Root == "" {
+		return utils.GetCurrentWorkingDirectory()
+	}
+	return opts.Root
+}
 
-	projectPath := filepath.Join(vaultDir, project, currentPath)
-	filesInProject, err := utils.ReadDirRecursiveFunc(projectPath)
+func ProjectExists(vaultDir string, project string) (bool, error) {
+	if project == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(filepath.Join(vaultDir, project))
+	if err != nil {
+		if os.IsNotExist(err) {
+			logrus.Debugf("Project does not exist in vault: %s", project)
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking project %s: %w", project, err)
+	}
+
+	return info.IsDir(), nil
+}
+
+// PlanCopyToProject computes what CopyEnvFilesToProject would do without touching the destination.
+func PlanCopyToProject(opts CopyOptions) (Plan, error) {
+	opts = opts.withDefaults()
+	logrus.Debugf("Vault directory details: vault_dir: %s, project: %s, current_path: %s, root: %s, overwrite: %s", opts.VaultDir, opts.Project, opts.CurrentPath, opts.root(), opts.Overwrite)
+
+	filesInProject, err := listCopySources(opts)
 	if err != nil {
-		return fmt.Errorf("error reading project path: %w", err)
+		return Plan{}, err
 	}
 
+	plan := Plan{Destination: filepath.Join(opts.root(), opts.CurrentPath)}
 	for _, file := range filesInProject {
-		if err := processCopyEnvFileToProject(file, projectPath, currentPath, vaultDir); err != nil {
-			logrus.Errorf("Error processing env file: file: %s, error: %v", file, err)
+		fileOpts := opts
+		fileOpts.overlay = file.Overlay
+		if len(opts.Files) > 0 {
+			managed, ok := matchProjectFile(opts.Files, filepath.ToSlash(filepath.Join(opts.CurrentPath, file.Path)))
+			if !ok {
+				logrus.Debugf("Skipping file not listed in the project config: %s", file.Path)
+				continue
+			}
+			if managed.Overwrite != "" {
+				fileOpts.Overwrite = managed.Overwrite
+			}
 		}
+
+		entry, err := planCopyEnvFileToProject(file.Source, file.Path, fileOpts)
+		if err != nil {
+			logrus.Debugf("Error planning env file: file: %s, error: %v", file.Source, err)
+			entry = PlanEntry{Source: file.Source, Overlay: file.Overlay, Destination: filepath.Join(plan.Destination, file.Path), Action: ActionError, Error: err.Error()}
+		}
+		plan.Entries = append(plan.Entries, entry)
 	}
-	return nil
+	return plan, nil
 }
 
-var copyFileWithSpinnerFunc = copyFileWithSpinner
+// CopyEnvFilesToProject copies the files of a vault project into the working tree. Once ctx is canceled,
+// the file being copied is finished and the remaining files are left alone. A file that fails does not stop
+// the others; the returned error reports the failures, which are listed in the results.
+func CopyEnvFilesToProject(ctx context.Context, opts CopyOptions) (Results, error) {
+	opts = opts.withDefaults()
 
-func processCopyEnvFileToProject(file, projectPath, currentPath string, vaultDir string) error {
-	relativePath, err := filepath.Rel(projectPath, file)
+	plan, err := PlanCopyToProject(opts)
 	if err != nil {
-		return fmt.Errorf("failed to compute relative path: %w", err)
+		return Results{}, err
+	}
+
+	var results Results
+	for _, entry := range plan.Entries {
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("copy interrupted: %w", err)
+		}
+		status, err := processCopyEnvFileToProject(ctx, entry, opts)
+		if err != nil {
+			logrus.Debugf("Error processing env file: file: %s, error: %v", entry.Source, err)
+			fmt.Printf("%s %s %s: %v\n", utils.ErrorIcon(), utils.WhiteText("Failed"), utils.CyanText(prettifiedPath(entry.Destination, opts.VaultDir)), err)
+		}
+		results.add(entry, status, err)
+	}
+	return results, results.Err()
+}
+
+var copyFileWithSpinnerFunc = copyFileWithSpinner
+
+// planCopyEnvFileToProject plans copying file to relativePath below the current path of the working directory.
+func planCopyEnvFileToProject(file, relativePath string, opts CopyOptions) (PlanEntry, error) {
+	destinationPath := filepath.Join(opts.root(), opts.CurrentPath)
+	entry := PlanEntry{
+		Source:      file,
+		Overlay:     opts.overlay,
+		Destination: filepath.Join(destinationPath, relativePath),
 	}
-	destinationPath := filepath.Join(utils.GetCurrentWorkingDirectory(), currentPath)
-	destinationPathWithFile := filepath.Join(destinationPath, relativePath)
 
 	fileExists, err := utils.CheckFileExists(destinationPath, relativePath)
 	if err != nil {
-		return fmt.Errorf("error checking file existence: %w", err)
+		return PlanEntry{}, fmt.Errorf("error checking file existence: %w", err)
 	}
 
 	if !fileExists {
-		logrus.Debugf("File does not exist, proceeding to copy: %s", file)
-		return copyFileWithSpinnerFunc(file, destinationPathWithFile, vaultDir)
+		entry.Action = ActionCreate
+		return entry, nil
+	}
+
+	identical, err := vaultFileIdentical(file, entry.Destination, opts)
+	if err != nil {
+		return PlanEntry{}, fmt.Errorf("error comparing files: %w", err)
 	}
 
-	logrus.Debugf("File exists, prompting for overwrite: %s", destinationPathWithFile)
-	return handleExistingFile(file, destinationPathWithFile, vaultDir)
+	if !identical && opts.Overwrite == OverwriteMerge {
+		merged, err := mergeEnvFiles(file, entry.Destination, opts)
+		if err != nil {
+			return PlanEntry{}, err
+		}
+		current, err := os.ReadFile(entry.Destination)
+		if err != nil {
+			return PlanEntry{}, fmt.Errorf("failed to read %s: %w", entry.Destination, err)
+		}
+		identical = merged == string(current)
+	}
+
+	switch {
+	case identical:
+		entry.Action = ActionIdentical
+	case opts.Overwrite == OverwriteMerge:
+		entry.Action = ActionMerge
+	case opts.Overwrite == OverwriteAlways:
+		entry.Action = ActionOverwrite
+	case opts.Overwrite == OverwriteNever:
+		entry.Action = ActionSkip
+	default:
+		entry.Action = ActionPrompt
+	}
+	return entry, nil
+}
+
+// vaultFileIdentical reports whether the plaintext of a vault file, with the profile file of opts layered on
+// it, matches the local file.
+func vaultFileIdentical(vaultPath, localPath string, opts CopyOptions) (bool, error) {
+	if !opts.Keys.Encrypts() && opts.overlay == "" {
+		return utils.FilesIdentical(vaultPath, localPath)
+	}
+
+	vaultData, err := opts.readSource(vaultPath)
+	if err != nil {
+		return false, err
+	}
+	localData, err := os.ReadFile(localPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file %s: %w", localPath, err)
+	}
+	return bytes.Equal(vaultData, localData), nil
+}
+
+func processCopyEnvFileToProject(ctx context.Context, entry PlanEntry, opts CopyOptions) (FileStatus, error) {
+	opts.overlay = entry.Overlay
+	switch entry.Action {
+	case ActionCreate:
+		logrus.Debugf("Copying file (%s): %s", entry.Action, entry.Source)
+		return StatusCreated, copyFileWithSpinnerFunc(entry.Source, entry.Destination, opts)
+	case ActionOverwrite:
+		logrus.Debugf("Copying file (%s): %s", entry.Action, entry.Source)
+		return StatusOverwritten, copyFileWithSpinnerFunc(entry.Source, entry.Destination, opts)
+	case ActionMerge:
+		logrus.Debugf("Merging file (prefer %s): %s", opts.Prefer, entry.Source)
+		return StatusMerged, mergeFileFunc(entry.Source, entry.Destination, opts)
+	case ActionIdentical:
+		logrus.Debugf("File is identical, nothing to copy: %s", entry.Destination)
+		fmt.Printf("%s %s %s\n", utils.SuccessIcon(), utils.WhiteText("Unchanged"), utils.CyanText(prettifiedPath(entry.Destination, opts.VaultDir)))
+		return StatusUnchanged, nil
+	case ActionError:
+		return StatusFailed, errors.New(entry.Error)
+	default:
+		// The plan already resolved the overwrite mode of the file, which may differ from opts.Overwrite.
+		logrus.Debugf("File exists, asking before overwriting: %s", entry.Destination)
+		opts.Overwrite = OverwritePrompt
+		return handleExistingFile(ctx, entry.Source, entry.Destination, opts)
+	}
 }
 
 func prettifiedPath(path, vaultDir string) string {
@@ -167,128 +425,503 @@ func prettifiedPath(path, vaultDir string) string {
 	return path
 }
 
-func copyFileWithSpinner(sourcePath, destinationPath string, vaultDir string) error {
+func copyFileWithSpinner(sourcePath, destinationPath string, opts CopyOptions) error {
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
 	s.Prefix = fmt.Sprintf("Copying %s to %s", sourcePath, destinationPath)
 	s.Start()
+	defer s.Stop()
+
+	// The journal is written first, so that it records the directories created for the file.
+	if opts.Journal != nil {
+		if err := opts.Journal.Record(destinationPath); err != nil {
+			return fmt.Errorf("refusing to write %s without a journal entry: %w", destinationPath, err)
+		}
+	}
 
 	destDir := filepath.Dir(destinationPath)
 	logrus.Debugf("Creating directory: %s", destDir)
-	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
-		logrus.Errorf("Failed to create directory %s: %v", destDir, err)
+	if err := os.MkdirAll(destDir, VaultDirMode); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", destDir, err)
 	}
 
 	logrus.Debugf("Copying file from %s to %s", sourcePath, destinationPath)
-	if err := utils.CopyFileFunc(sourcePath, destinationPath); err != nil {
-		logrus.Errorf("Failed to copy file from %s to %s: %v", sourcePath, destinationPath, err)
+	if err := copyVaultFile(sourcePath, destinationPath, opts); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", prettifiedPath(sourcePath, opts.VaultDir), err)
+	}
+	if opts.Journal != nil {
+		// The file was written, so a journal that cannot be updated only means undo will treat it as changed.
+		if err := opts.Journal.Written(destinationPath); err != nil {
+			logrus.Warnf("Failed to update journal for %s: %v", destinationPath, err)
+		}
 	}
 	logrus.Debugf("File copied successfully: %s", destinationPath)
 
 	s.Stop()
+	fmt.Printf("%s %s %s %s %s\n", utils.SuccessIcon(), utils.WhiteText("Copied"), utils.CyanText(sourceLabel(sourcePath, opts.overlay, opts.VaultDir)), utils.WhiteText("to"), utils.CyanText(prettifiedPath(destinationPath, opts.VaultDir)))
+	return nil
+}
+
+// copyVaultFile copies a vault file to the working tree, decrypting it and layering the profile file of opts on
+// it when needed, and gives it the file mode of opts.
+func copyVaultFile(sourcePath, destinationPath string, opts CopyOptions) error {
+	if opts.overlay == "" && (opts.Keys == nil || len(opts.Keys.Identities) == 0) {
+		if err := utils.CopyFileFunc(sourcePath, destinationPath); err != nil {
+			return err
+		}
+	} else {
+		data, err := opts.readSource(sourcePath)
+		if err != nil {
+			return err
+		}
+		if err := WriteVaultFile(destinationPath, data, nil, opts.FileMode); err != nil {
+			return err
+		}
+	}
 
-	fmt.Printf("%s %s %s %s %s\n", utils.SuccessIcon(), utils.WhiteText("Copied"), utils.CyanText(prettifiedPath(sourcePath, vaultDir)), utils.WhiteText("to"), utils.CyanText(prettifiedPath(destinationPath, vaultDir)))
+	// Existing files keep their mode when written to, so the mode is always applied afterwards.
+	if err := os.Chmod(destinationPath, opts.FileMode); err != nil {
+		return fmt.Errorf("failed to change mode of %s: %w", destinationPath, err)
+	}
 	return nil
 }
 
-func handleExistingFile(sourcePath, destinationPath string, vaultDir string) error {
+func handleExistingFile(ctx context.Context, sourcePath, destinationPath string, opts CopyOptions) (FileStatus, error) {
+	switch opts.Overwrite {
+	case OverwriteAlways:
+		logrus.Debugf("Overwriting existing file without prompting: %s", destinationPath)
+		return StatusOverwritten, copyFileWithSpinnerFunc(sourcePath, destinationPath, opts)
+	case OverwriteNever:
+		logrus.Debugf("Skipping existing file without prompting: %s", destinationPath)
+		fmt.Printf("%s %s %s\n", utils.WarningIcon(), utils.WhiteText("Skipped existing"), utils.CyanText(prettifiedPath(destinationPath, opts.VaultDir)))
+		return StatusSkipped, nil
+	}
+
 	fmt.Printf("\n%s %s\n", utils.InfoIcon(), fmt.Sprintf("Processing for: %s", utils.CyanText(destinationPath)))
-	fmt.Printf("%s ", "File exists! Do you want to overwrite? (y/N): ")
+	fmt.Printf("%s ", "File exists! Overwrite, merge keys or skip? (y/m/N): ")
 
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := readAnswer(ctx, opts.Input)
 	if err != nil {
-		logrus.Fatalf("Failed to read input: %v", err)
+		return StatusFailed, fmt.Errorf("failed to read input: %w", err)
 	}
-	input = strings.TrimSpace(input)
-	if strings.ToLower(input) != "y" {
+	switch strings.ToLower(input) {
+	case "y":
+		return StatusOverwritten, copyFileWithSpinnerFunc(sourcePath, destinationPath, opts)
+	case "m":
+		return StatusMerged, mergeFileFunc(sourcePath, destinationPath, opts)
+	default:
 		logrus.Debugf("User chose not to overwrite file: %s", destinationPath)
 		fmt.Printf("%s %s\n", utils.WarningIcon(), utils.WhiteText("Skipped."))
-		return nil
+		return StatusSkipped, nil
 	}
+}
 
-	return copyFileWithSpinnerFunc(sourcePath, destinationPath, vaultDir)
+// mergeEnvFiles returns the content of destinationPath with the keys of sourcePath, and of the profile file
+// layered on it, merged into it.
+func mergeEnvFiles(sourcePath, destinationPath string, opts CopyOptions) (string, error) {
+	data, err := opts.readSource(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("cannot merge: %w", err)
+	}
+	source, err := dotenv.ParseString(string(data))
+	if err != nil {
+		return "", fmt.Errorf("cannot merge: failed to parse %s: %w", sourcePath, err)
+	}
+	destination, err := dotenv.ParseFile(destinationPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot merge: %w", err)
+	}
+	merged, err := dotenv.Merge(destination, source, opts.Prefer == PreferVault)
+	if err != nil {
+		return "", fmt.Errorf("cannot merge: %w", err)
+	}
+	return merged.String(), nil
 }
 
-var exitFunc = os.Exit
+var mergeFileFunc = mergeFile
 
-func ConfirmCwd() error {
-	dir := utils.GetCurrentWorkingDirectory()
-	logrus.Debugf("Current working directory: %s", dir)
+func mergeFile(sourcePath, destinationPath string, opts CopyOptions) error {
+	opts = opts.withDefaults()
+	merged, err := mergeEnvFiles(sourcePath, destinationPath, opts)
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("%s %s\n\n", utils.InfoIcon(), fmt.Sprintf("Current working directory: %s", utils.CyanText(dir)))
-	fmt.Printf("%s ", "Is this your root directory to perform the backup? (y/N): ")
+	if opts.Journal != nil {
+		if err := opts.Journal.Record(destinationPath); err != nil {
+			return fmt.Errorf("refusing to write %s without a journal entry: %w", destinationPath, err)
+		}
+	}
+
+	logrus.Debugf("Writing merged file: %s", destinationPath)
+	if err := utils.WriteFileAtomic(destinationPath, []byte(merged), opts.FileMode); err != nil {
+		return fmt.Errorf("failed to write merged file %s: %w", destinationPath, err)
+	}
+	if opts.Journal != nil {
+		if err := opts.Journal.Written(destinationPath); err != nil {
+			logrus.Warnf("Failed to update journal for %s: %v", destinationPath, err)
+		}
+	}
 
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	fmt.Printf("%s %s %s %s %s\n", utils.SuccessIcon(), utils.WhiteText("Merged"), utils.CyanText(sourceLabel(sourcePath, opts.overlay, opts.VaultDir)), utils.WhiteText("into"), utils.CyanText(prettifiedPath(destinationPath, opts.VaultDir)))
+	return nil
+}
+
+// readAnswer reads a single line from input. A final line without a trailing newline is still accepted.
+// It stops waiting when ctx is canceled, e.g. by Ctrl-C. A read cannot be canceled, so the goroutine reading
+// input stays blocked until input yields a line or is closed; cpenv exits right after an interrupt, so this
+// only matters to callers that keep prompting after ctx was canceled, which none do.
+func readAnswer(ctx context.Context, input io.Reader) (string, error) {
+	if input == nil {
+		input = os.Stdin
+	}
+
+	type answer struct {
+		line string
+		err  error
+	}
+	answers := make(chan answer, 1)
+	go func() {
+		line, err := bufio.NewReader(input).ReadString('\n')
+		answers <- answer{line: line, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case a := <-answers:
+		if a.err != nil && (a.err != io.EOF || a.line == "") {
+			return "", a.err
+		}
+		return strings.TrimSpace(a.line), nil
+	}
+}
+
+var exitFunc = os.Exit
+
+// ConfirmRoot asks whether the env files below root should be backed up, and exits when the answer is not yes.
+func ConfirmRoot(ctx context.Context, root ProjectRoot) error {
+	fmt.Printf("%s ", "Back up the env files of this directory? (y/N): ")
+
+	input, err := readAnswer(ctx, os.Stdin)
 	if err != nil {
-		logrus.Fatalf("Failed to read input: %v", err)
+		return fmt.Errorf("failed to read input: %w", err)
 	}
-	input = strings.TrimSpace(input)
 	if strings.ToLower(input) != "y" {
-		logrus.Debugf("User chose not to backup to: %s", dir)
-		fmt.Printf("%s %s\n", utils.WarningIcon(), utils.WhiteText("Aborted... cd to your desired directory and restart the backup again."))
+		logrus.Debugf("User chose not to backup: %s", root.Dir)
+		fmt.Printf("%s %s\n", utils.WarningIcon(), utils.WhiteText("Aborted... use --root to back up another directory."))
 		exitFunc(0)
 		return nil
 	}
 
-	logrus.Debug("Current working directory confirmed by user")
+	logrus.Debug("Project root confirmed by user")
 	return nil
 }
 
-func CopyEnvFilesToVault(vaultDir string) error {
-	logrus.Debugf("Vault directory details: %s", vaultDir)
+// DefaultInclude, DefaultExclude and DefaultPrune are the backup patterns used when the config does not set its own.
+var (
+	DefaultInclude = []string{"**/*.env"}
+	DefaultExclude = []string{"**/node_modules/**", "**/*.template*", "**/*.example*"}
+	DefaultPrune   = []string{"node_modules", "vendor", "target"}
+)
 
-	dir := utils.GetCurrentWorkingDirectory()
-	logrus.Debugf("Current working directory for backup: %s", dir)
+// BackupOptions controls which files of the project root are backed up.
+type BackupOptions struct {
+	VaultDir string
+	// Root is the directory that is backed up and defaults to the current working directory.
+	Root string
+	// Include and Exclude are doublestar globs matched against paths relative to Root.
+	// A file is backed up when it matches an include pattern and no exclude pattern.
+	Include []string
+	Exclude []string
+	// Prune lists directories that are never descended into, see utils.PruneOptions.
+	Prune []string
+	// Gitignore also prunes directories ignored by .gitignore and .git/info/exclude.
+	Gitignore bool
+	// Force creates a new backup even when nothing changed since the latest one.
+	Force bool
+	// Keys encrypt the backup when the vault is encrypted.
+	Keys *Keys
+	// Project names the backups and defaults to the name of Root.
+	Project string
+}
 
-	currentProjectFolderName := filepath.Base(dir)
-	if currentProjectFolderName == "" {
-		return fmt.Errorf("failed to parse the folder name, try again")
+// root returns the directory that is backed up.
+func (opts BackupOptions) root() string {
+	if opts.Root == "" {
+		return utils.GetCurrentWorkingDirectory()
 	}
+	return opts.Root
+}
 
-	currentProjectFolderNameWithTimestamp := fmt.Sprintf("%s-%s", currentProjectFolderName, utils.GetBackupTimestamp())
-	logrus.Debugf("Current project folder with timestamp: %s", currentProjectFolderNameWithTimestamp)
+func (opts BackupOptions) withDefaults() BackupOptions {
+	if opts.Include == nil {
+		opts.Include = DefaultInclude
+	}
+	if opts.Exclude == nil {
+		opts.Exclude = DefaultExclude
+	}
+	if opts.Prune == nil {
+		opts.Prune = DefaultPrune
+	}
+	return opts
+}
 
-	destinationPath := filepath.Join(vaultDir, currentProjectFolderNameWithTimestamp)
-	logrus.Debugf("Destination path for backup: %s", destinationPath)
+var backupTimestampFunc = utils.GetBackupTimestamp
+
+// PlanCopyToVault computes the backup of the project root without creating anything in the vault.
+func PlanCopyToVault(opts BackupOptions) (Plan, error) {
+	opts = opts.withDefaults()
+	logrus.Debugf("Vault directory details: vault_dir: %s, include: %v, exclude: %v, prune: %v, gitignore: %t", opts.VaultDir, opts.Include, opts.Exclude, opts.Prune, opts.Gitignore)
+
+	if err := utils.ValidatePatterns(opts.Include); err != nil {
+		return Plan{}, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	if err := utils.ValidatePatterns(opts.Exclude); err != nil {
+		return Plan{}, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+	if err := utils.ValidatePatterns(opts.Prune); err != nil {
+		return Plan{}, fmt.Errorf("invalid prune pattern: %w", err)
+	}
+
+	dir := opts.root()
+	logrus.Debugf("Root directory for backup: %s", dir)
 
-	if err := os.MkdirAll(destinationPath, os.ModePerm); err != nil {
-		logrus.Errorf("Failed to create destination path: %v", err)
-		return fmt.Errorf("failed to create destination path: %w", err)
+	currentProjectFolderName := opts.Project
+	if currentProjectFolderName == "" {
+		currentProjectFolderName = filepath.Base(dir)
 	}
-	logrus.Debugf("Destination path created: %s", destinationPath)
+	if currentProjectFolderName == "" {
+		return Plan{}, fmt.Errorf("failed to parse the folder name, try again")
+	}
+
+	destinationPath := filepath.Join(BackupsDir(opts.VaultDir), currentProjectFolderName, backupTimestampFunc())
+	logrus.Debugf("Destination path for backup: %s", destinationPath)
 
-	filesInProject, err := utils.ReadDirRecursiveFunc(dir)
+	filesInProject, err := utils.ReadDirPrunedFunc(dir, utils.PruneOptions{Prune: opts.Prune, Gitignore: opts.Gitignore})
 	if err != nil {
-		return fmt.Errorf("error reading project path: %w", err)
+		return Plan{}, fmt.Errorf("error reading project path: %w", err)
 	}
 
+	plan := Plan{Destination: destinationPath}
 	for _, file := range filesInProject {
-		if err := processCopyEnvFileToVault(file, dir, destinationPath, vaultDir); err != nil {
-			logrus.Errorf("Error processing env file: file: %s, error: %v", file, err)
+		if entry, ok := planCopyEnvFileToVault(file, dir, destinationPath, opts); ok {
+			plan.Entries = append(plan.Entries, entry)
 		}
 	}
-	return nil
+
+	if opts.Force || len(plan.Entries) == 0 {
+		return plan, nil
+	}
+
+	latest, ok, err := latestBackup(opts.VaultDir, currentProjectFolderName)
+	if err != nil {
+		return Plan{}, err
+	}
+	if !ok {
+		return plan, nil
+	}
+
+	latestPath := filepath.Join(opts.VaultDir, latest.Name)
+	unchanged, err := backupUnchanged(plan, dir, opts.VaultDir, latestPath, opts.Keys)
+	if err != nil {
+		return Plan{}, err
+	}
+	if unchanged {
+		logrus.Debugf("Nothing changed since the latest backup: %s", latestPath)
+		plan.Destination = latestPath
+		for i, entry := range plan.Entries {
+			relativePath, _ := filepath.Rel(dir, entry.Source)
+			plan.Entries[i].Destination = filepath.Join(latestPath, relativePath)
+			plan.Entries[i].Action = ActionIdentical
+		}
+	}
+	return plan, nil
 }
 
-func processCopyEnvFileToVault(file, cwd, destinationPath string, vaultDir string) error {
-	fileName := filepath.Base(file)
-	fullPath, _ := filepath.Abs(file)
+func latestBackup(vaultDir, project string) (Backup, bool, error) {
+	backups, err := ListBackups(vaultDir)
+	if err != nil {
+		return Backup{}, false, fmt.Errorf("error reading backups: %w", err)
+	}
+	backups = FilterBackups(backups, project)
+	if len(backups) == 0 {
+		return Backup{}, false, nil
+	}
+	return backups[0], true, nil
+}
 
-	if strings.Contains(fullPath, "node_modules") || strings.Contains(fileName, ".template") || strings.Contains(fileName, ".example") {
-		logrus.Debugf("Skipping file: %s", file)
-		return nil
+// backupUnchanged reports whether the planned files have the same paths and object names as the backup.
+func backupUnchanged(plan Plan, root, vaultDir, backupPath string, keys *Keys) (bool, error) {
+	backupFiles, err := listSnapshotFiles(vaultDir, backupPath, "")
+	if err != nil {
+		return false, fmt.Errorf("error reading backup: %w", err)
+	}
+	if len(plan.Entries) != len(backupFiles) {
+		return false, nil
 	}
 
-	if !strings.HasSuffix(fileName, ".env") {
-		logrus.Debugf("Skipping non-env file: %s", file)
-		return nil
+	backedUp := make(map[string]snapshotFile, len(backupFiles))
+	for _, file := range backupFiles {
+		backedUp[file.Path] = file
 	}
 
-	relativePath := strings.TrimPrefix(file, cwd+"/")
-	sourcePath := filepath.Join(cwd, relativePath)
-	destinationPathWithFile := filepath.Join(destinationPath, relativePath)
+	for _, entry := range plan.Entries {
+		relativePath, err := filepath.Rel(root, entry.Source)
+		if err != nil {
+			return false, nil
+		}
+		previous, ok := backedUp[relativePath]
+		if !ok {
+			return false, nil
+		}
+
+		data, err := os.ReadFile(entry.Source)
+		if err != nil {
+			return false, err
+		}
+		current, err := keys.objectName(data)
+		if err != nil {
+			return false, err
+		}
+		if previous.Hash == "" {
+			data, err := ReadVaultFile(previous.Source, keys)
+			if err != nil {
+				return false, err
+			}
+			if previous.Hash, err = keys.objectName(data); err != nil {
+				return false, err
+			}
+		}
+		if current != previous.Hash {
+			logrus.Debugf("File changed since the latest backup: %s", relativePath)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// CopyEnvFilesToVault backs up the env files of the working tree. When ctx is canceled or a file fails, no
+// manifest is written, so an incomplete backup never shows up as a snapshot. The files that fail are
+// reported by the returned error.
+func CopyEnvFilesToVault(ctx context.Context, opts BackupOptions) (Results, error) {
+	plan, err := PlanCopyToVault(opts)
+	if err != nil {
+		return Results{}, err
+	}
+
+	if len(plan.Entries) > 0 && plan.Count(ActionIdentical) == len(plan.Entries) {
+		since := filepath.Base(plan.Destination)
+		if timestamp, ok := parseSnapshotName(since); ok {
+			since = timestamp.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%s %s %s\n", utils.SuccessIcon(), utils.WhiteText("No changes since"), utils.CyanText(since))
+		return Results{}, nil
+	}
+
+	destination, err := createBackupDestination(plan.Destination)
+	if err != nil {
+		return Results{}, err
+	}
+	for i, entry := range plan.Entries {
+		relativePath, err := filepath.Rel(plan.Destination, entry.Destination)
+		if err != nil {
+			return Results{}, fmt.Errorf("failed to compute relative path: %w", err)
+		}
+		plan.Entries[i].Destination = filepath.Join(destination, relativePath)
+	}
+	plan.Destination = destination
+	logrus.Debugf("Destination path created: %s", plan.Destination)
+
+	var results Results
+	manifest := Manifest{}
+	for _, entry := range plan.Entries {
+		if err := ctx.Err(); err != nil {
+			removeBackupDestination(plan.Destination)
+			return results, fmt.Errorf("backup interrupted: %w", err)
+		}
+		manifestEntry, err := processCopyEnvFileToVault(entry, plan.Destination, opts.VaultDir, opts.Keys)
+		results.add(entry, StatusCreated, err)
+		if err != nil {
+			logrus.Debugf("Error processing env file: file: %s, error: %v", entry.Source, err)
+			fmt.Printf("%s %s %s: %v\n", utils.ErrorIcon(), utils.WhiteText("Failed"), utils.CyanText(prettifiedPath(entry.Source, opts.VaultDir)), err)
+			continue
+		}
+		manifest.Files = append(manifest.Files, manifestEntry)
+	}
+	if err := results.Err(); err != nil {
+		// Stored objects are left to the garbage collection of the next prune.
+		removeBackupDestination(plan.Destination)
+		return results, err
+	}
+	return results, WriteManifest(plan.Destination, manifest)
+}
+
+// createBackupDestination creates the folder of a new backup. A backup taken within the same second as an
+// existing one gets a `-2`, `-3`, ... suffix instead of overwriting its manifest.
+func createBackupDestination(destination string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(destination), VaultDirMode); err != nil {
+		return "", fmt.Errorf("failed to create destination path: %w", err)
+	}
+
+	path := destination
+	for i := 2; ; i++ {
+		err := os.Mkdir(path, VaultDirMode)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", fmt.Errorf("failed to create destination path: %w", err)
+		}
+		path = fmt.Sprintf("%s-%d", destination, i)
+	}
+}
+
+// removeBackupDestination removes the folder of a backup that was not completed, and the folder of its project
+// when it was the first backup. Remove fails on purpose when the project already has other backups.
+func removeBackupDestination(destination string) {
+	os.Remove(destination)
+	os.Remove(filepath.Dir(destination))
+}
+
+func planCopyEnvFileToVault(file, root, destinationPath string, opts BackupOptions) (PlanEntry, bool) {
+	relativePath, err := filepath.Rel(root, file)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		logrus.Debugf("Skipping file outside of the root: %s", file)
+		return PlanEntry{}, false
+	}
+
+	if !utils.MatchAny(opts.Include, relativePath) {
+		logrus.Debugf("Skipping file not matching include patterns: %s", file)
+		return PlanEntry{}, false
+	}
+
+	if utils.MatchAny(opts.Exclude, relativePath) {
+		logrus.Debugf("Skipping excluded file: %s", file)
+		return PlanEntry{}, false
+	}
+
+	return PlanEntry{
+		Source:      filepath.Join(root, relativePath),
+		Destination: filepath.Join(destinationPath, relativePath),
+		Action:      ActionCreate,
+	}, true
+}
+
+// processCopyEnvFileToVault stores the file in the object store and returns its manifest entry for the backup.
+func processCopyEnvFileToVault(entry PlanEntry, backupPath, vaultDir string, keys *Keys) (ManifestEntry, error) {
+	logrus.Debugf("Storing env file in vault: source: %s, destination: %s", entry.Source, entry.Destination)
+
+	relativePath, err := filepath.Rel(backupPath, entry.Destination)
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to compute relative path: %w", err)
+	}
+
+	manifestEntry, err := StoreObject(vaultDir, entry.Source, keys)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	manifestEntry.Path = filepath.ToSlash(relativePath)
 
-	logrus.Debugf("Copying env file to vault: source: %s, destination: %s", sourcePath, destinationPathWithFile)
-	return copyFileWithSpinnerFunc(sourcePath, destinationPathWithFile, vaultDir)
+	fmt.Printf("%s %s %s %s %s\n", utils.SuccessIcon(), utils.WhiteText("Backed up"), utils.CyanText(prettifiedPath(entry.Source, vaultDir)), utils.WhiteText("to"), utils.CyanText(prettifiedPath(entry.Destination, vaultDir)))
+	return manifestEntry, nil
 }
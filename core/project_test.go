@@ -1,7 +1,10 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -52,12 +55,28 @@ func TestGetProjectsList_Success(t *testing.T) {
 	assert.Contains(t, names, "proj2")
 }
 
+func TestGetProjectsList_SkipsDotDirectories(t *testing.T) {
+	tempDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(tempDir, ".backups", "proj1"), 0755))
+	assert.NoError(t, os.Mkdir(filepath.Join(tempDir, "proj1"), 0755))
+
+	projects, err := GetProjectsList(tempDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []utils.Directory{{Name: "proj1", Value: "proj1"}}, projects)
+
+	onlyBackups := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(onlyBackups, ".backups"), 0755))
+	_, err = GetProjectsList(onlyBackups)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no projects found in the vault")
+}
+
 // ---------------------------
 // Tests for SelectProject
 // ---------------------------
 
 func TestSelectProject_EmptyProjects(t *testing.T) {
-	selected, err := SelectProject([]utils.Directory{})
+	selected, err := SelectProject([]utils.Directory{}, "")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no projects found in the vault")
 	assert.Empty(t, selected)
@@ -71,11 +90,30 @@ func TestSelectProject_Success(t *testing.T) {
 		return 0, "project1", nil
 	}
 	projects := []utils.Directory{{Name: "project1"}, {Name: "project2"}}
-	selected, err := SelectProject(projects)
+	selected, err := SelectProject(projects, "")
 	assert.NoError(t, err)
 	assert.Equal(t, "project1", selected)
 }
 
+func TestSelectProject_Preselect(t *testing.T) {
+	origSelectRun := selectProjectRun
+	defer func() { selectProjectRun = origSelectRun }()
+	var cursor int
+	selectProjectRun = func(prompt promptui.Select) (int, string, error) {
+		cursor = prompt.CursorPos
+		return 0, "project1", nil
+	}
+	projects := []utils.Directory{{Name: "project1"}, {Name: "project2"}}
+
+	_, err := SelectProject(projects, "project2")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cursor)
+
+	_, err = SelectProject(projects, "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cursor)
+}
+
 func TestSelectProject_NoSelection(t *testing.T) {
 	// Simulate a prompt run that returns an empty string.
 	origSelectRun := selectProjectRun
@@ -84,7 +122,7 @@ func TestSelectProject_NoSelection(t *testing.T) {
 		return 0, "", nil
 	}
 	projects := []utils.Directory{{Name: "project1"}}
-	selected, err := SelectProject(projects)
+	selected, err := SelectProject(projects, "")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no project selected")
 	assert.Empty(t, selected)
@@ -99,7 +137,7 @@ func TestSelectProject_RunError(t *testing.T) {
 		return 0, "", testErr
 	}
 	projects := []utils.Directory{{Name: "project1"}}
-	selected, err := SelectProject(projects)
+	selected, err := SelectProject(projects, "")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "error starting the selection form")
 	assert.Empty(t, selected)
@@ -122,7 +160,7 @@ func TestSelectProject_PromptInterrupt(t *testing.T) {
 		panic("exit")
 	}
 	projects := []utils.Directory{{Name: "project1"}}
-	assert.Panics(t, func() { SelectProject(projects) })
+	assert.Panics(t, func() { SelectProject(projects, "") })
 	assert.Equal(t, 0, exitCode)
 }
 
@@ -225,7 +263,7 @@ func TestPrettifiedPath(t *testing.T) {
 func TestCopyEnvFilesToProject_ReadDirError(t *testing.T) {
 	// Provide a vaultDir that does not exist so that ReadDirRecursive returns an error.
 	nonExistentDir := filepath.Join(t.TempDir(), "nonexistent")
-	err := CopyEnvFilesToProject("dummyProject", "dummyCurrent", nonExistentDir)
+	_, err := CopyEnvFilesToProject(context.Background(), CopyOptions{Project: "dummyProject", CurrentPath: "dummyCurrent", VaultDir: nonExistentDir})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "error reading project path")
 }
@@ -255,7 +293,7 @@ func TestCopyEnvFilesToProject_Success(t *testing.T) {
 	var recordedSource, recordedDest string
 	origCopySpinner := copyFileWithSpinnerFunc
 	defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
-	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, vaultDir string) error {
+	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
 		recordedSource = sourcePath
 		recordedDest = destinationPath
 		return nil
@@ -273,7 +311,7 @@ func TestCopyEnvFilesToProject_Success(t *testing.T) {
 	}()
 
 	// Call the function under test.
-	err = CopyEnvFilesToProject(project, currentPath, tempDir)
+	_, err = CopyEnvFilesToProject(context.Background(), CopyOptions{Project: project, CurrentPath: currentPath, VaultDir: tempDir})
 	assert.NoError(t, err)
 
 	// Expected destination is based on the temporary working directory.
@@ -284,6 +322,61 @@ func TestCopyEnvFilesToProject_Success(t *testing.T) {
 	assert.Equal(t, dummyFile, recordedSource)
 }
 
+func TestPlanCopyEnvFileToProject_FileNotExists(t *testing.T) {
+	// Test branch where the destination file does not exist.
+	tempProject := t.TempDir()
+	currentPath := "current"
+	dummyFile := filepath.Join(tempProject, "file.env")
+	assert.NoError(t, os.WriteFile(dummyFile, []byte("data"), 0644))
+	tempCwd := t.TempDir()
+	origWd, _ := utils.GetWdFunc()
+	os.Chdir(tempCwd)
+	defer os.Chdir(origWd)
+	entry, err := planCopyEnvFileToProject(dummyFile, "file.env", CopyOptions{CurrentPath: currentPath, VaultDir: tempProject})
+	assert.NoError(t, err)
+	assert.Equal(t, ActionCreate, entry.Action)
+	assert.Equal(t, dummyFile, entry.Source)
+	assert.Equal(t, normalizePath(filepath.Join(tempCwd, currentPath, "file.env")), normalizePath(entry.Destination))
+}
+
+func TestPlanCopyEnvFileToProject_FileExists(t *testing.T) {
+	// Create a temporary project directory.
+	tempProject := t.TempDir()
+	currentPath := "current"
+	dummyFile := filepath.Join(tempProject, "file.env")
+	assert.NoError(t, os.WriteFile(dummyFile, []byte("data"), 0644))
+	sameFile := filepath.Join(tempProject, "same.env")
+	assert.NoError(t, os.WriteFile(sameFile, []byte("same"), 0644))
+	// Create a temporary working directory to simulate destination.
+	tempCwd := t.TempDir()
+	destDir := filepath.Join(tempCwd, currentPath)
+	assert.NoError(t, os.MkdirAll(destDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(destDir, "file.env"), []byte("existing"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(destDir, "same.env"), []byte("same"), 0644))
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	err = os.Chdir(tempCwd)
+	assert.NoError(t, err)
+	defer func() {
+		err = os.Chdir(origWd)
+		assert.NoError(t, err)
+	}()
+
+	for mode, want := range map[OverwriteMode]PlanAction{
+		OverwritePrompt: ActionPrompt,
+		OverwriteAlways: ActionOverwrite,
+		OverwriteNever:  ActionSkip,
+	} {
+		entry, err := planCopyEnvFileToProject(dummyFile, "file.env", CopyOptions{CurrentPath: currentPath, VaultDir: tempProject, Overwrite: mode})
+		assert.NoError(t, err)
+		assert.Equal(t, want, entry.Action, "mode %s", mode)
+
+		entry, err = planCopyEnvFileToProject(sameFile, "same.env", CopyOptions{CurrentPath: currentPath, VaultDir: tempProject, Overwrite: mode})
+		assert.NoError(t, err)
+		assert.Equal(t, ActionIdentical, entry.Action, "mode %s", mode)
+	}
+}
+
 func TestProcessCopyEnvFileToProject_FileNotExists(t *testing.T) {
 	// Test branch where the destination file does not exist.
 	tempProject := t.TempDir()
@@ -299,13 +392,17 @@ func TestProcessCopyEnvFileToProject_FileNotExists(t *testing.T) {
 	var called bool
 	origCopySpinner := copyFileWithSpinnerFunc
 	defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
-	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, vaultDir string) error {
+	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
 		called = true
 		return nil
 	}
-	err := processCopyEnvFileToProject(dummyFile, tempProject, currentPath, tempProject)
+	opts := CopyOptions{CurrentPath: currentPath, VaultDir: tempProject}
+	entry, err := planCopyEnvFileToProject(dummyFile, "file.env", opts)
+	assert.NoError(t, err)
+	status, err := processCopyEnvFileToProject(context.Background(), entry, opts)
 	assert.NoError(t, err)
 	assert.True(t, called)
+	assert.Equal(t, StatusCreated, status)
 }
 
 func TestProcessCopyEnvFileToProject_FileExists(t *testing.T) {
@@ -323,7 +420,7 @@ func TestProcessCopyEnvFileToProject_FileExists(t *testing.T) {
 	var called bool
 	origCopySpinner := copyFileWithSpinnerFunc
 	defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
-	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, vaultDir string) error {
+	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
 		called = true
 		return nil
 	}
@@ -335,20 +432,58 @@ func TestProcessCopyEnvFileToProject_FileExists(t *testing.T) {
 		err = os.Chdir(origWd)
 		assert.NoError(t, err)
 	}()
-	// Simulate user input "n\n" (do not overwrite) via os.Pipe.
-	origStdin := os.Stdin
-	r, w, err := os.Pipe()
+	// Simulate user input "n\n" (do not overwrite).
+	opts := CopyOptions{CurrentPath: currentPath, VaultDir: tempProject, Input: strings.NewReader("n\n")}
+	entry, err := planCopyEnvFileToProject(dummyFile, "file.env", opts)
 	assert.NoError(t, err)
-	_, err = w.WriteString("n\n")
-	assert.NoError(t, err)
-	w.Close()
-	os.Stdin = r
-	defer func() { os.Stdin = origStdin }()
-	err = processCopyEnvFileToProject(dummyFile, tempProject, currentPath, tempProject)
+	assert.Equal(t, ActionPrompt, entry.Action)
+	status, err := processCopyEnvFileToProject(context.Background(), entry, opts)
 	assert.NoError(t, err)
 	// Since the destination file exists and user chose not to overwrite,
 	// copyFileWithSpinnerFunc should not be called.
 	assert.False(t, called, "Expected copy function not to be called when user declines overwrite")
+	assert.Equal(t, StatusSkipped, status)
+}
+
+func TestProcessCopyEnvFileToProject(t *testing.T) {
+	tests := []struct {
+		action     PlanAction
+		input      string
+		wantCalled bool
+		wantStatus FileStatus
+	}{
+		{action: ActionCreate, wantCalled: true, wantStatus: StatusCreated},
+		{action: ActionOverwrite, wantCalled: true, wantStatus: StatusOverwritten},
+		{action: ActionIdentical, wantCalled: false, wantStatus: StatusUnchanged},
+		{action: ActionMerge, wantCalled: true, wantStatus: StatusMerged},
+		// Simulate user input "n\n" (do not overwrite).
+		{action: ActionPrompt, input: "n\n", wantCalled: false, wantStatus: StatusSkipped},
+		{action: ActionPrompt, input: "y\n", wantCalled: true, wantStatus: StatusOverwritten},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.action), func(t *testing.T) {
+			var called bool
+			origCopySpinner := copyFileWithSpinnerFunc
+			defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
+			copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
+				called = true
+				return nil
+			}
+			origMerge := mergeFileFunc
+			defer func() { mergeFileFunc = origMerge }()
+			mergeFileFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
+				called = true
+				return nil
+			}
+			entry := PlanEntry{Source: "dummySource", Destination: "dummyDest", Action: tt.action}
+			opts := CopyOptions{VaultDir: t.TempDir(), Input: strings.NewReader(tt.input)}
+			status, err := processCopyEnvFileToProject(context.Background(), entry, opts)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCalled, called)
+			assert.Equal(t, tt.wantStatus, status)
+		})
+	}
 }
 
 func TestCopyFileWithSpinner(t *testing.T) {
@@ -367,32 +502,128 @@ func TestCopyFileWithSpinner(t *testing.T) {
 		}
 		return os.WriteFile(destination, data, 0644)
 	}
-	err := copyFileWithSpinner(sourceFile, destFile, tempDir)
+	err := copyFileWithSpinner(sourceFile, destFile, CopyOptions{VaultDir: tempDir}.withDefaults())
 	assert.NoError(t, err)
 	data, err := os.ReadFile(destFile)
 	assert.NoError(t, err)
 	assert.Equal(t, content, string(data))
 }
 
-func TestHandleExistingFile_NotOverwrite(t *testing.T) {
+func TestCopyFileWithSpinner_Error(t *testing.T) {
 	tempDir := t.TempDir()
-	// Simulate user input "n" so that the file is not overwritten.
-	origStdin := os.Stdin
-	r, w, err := os.Pipe()
+	origCopyFile := utils.CopyFileFunc
+	defer func() { utils.CopyFileFunc = origCopyFile }()
+	utils.CopyFileFunc = func(source, destination string) error {
+		return errors.New("disk full")
+	}
+
+	err := copyFileWithSpinner(filepath.Join(tempDir, "source.env"), filepath.Join(tempDir, "dest.env"), CopyOptions{VaultDir: tempDir}.withDefaults())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "disk full")
+
+	// A file in place of the destination directory cannot be written below.
+	blocker := filepath.Join(tempDir, "blocker")
+	assert.NoError(t, os.WriteFile(blocker, []byte("x"), 0644))
+	err = copyFileWithSpinner(filepath.Join(tempDir, "source.env"), filepath.Join(blocker, "dest.env"), CopyOptions{VaultDir: tempDir}.withDefaults())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create directory")
+}
+
+func TestCopyEnvFilesToProject_AggregatesFailures(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env", "apps/api/.env", "apps/web/.env")
+
+	tempCwd := t.TempDir()
+	origWd, err := utils.GetWdFunc()
 	assert.NoError(t, err)
-	_, err = w.WriteString("n\n")
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	origCopySpinner := copyFileWithSpinnerFunc
+	defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
+	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
+		if strings.Contains(destinationPath, filepath.Join("apps", "api")) {
+			return errors.New("permission denied")
+		}
+		return origCopySpinner(sourcePath, destinationPath, opts)
+	}
+
+	results, err := CopyEnvFilesToProject(context.Background(), CopyOptions{Project: "web", VaultDir: vaultDir})
+	assert.Error(t, err, "Expected a failed file to fail the copy")
+	assert.Contains(t, err.Error(), "1 of 3 file(s) failed")
+	assert.Equal(t, 2, results.Count(StatusCreated), "Expected the other files to be copied anyway")
+	if assert.Equal(t, 1, results.Count(StatusFailed)) {
+		for _, file := range results.Files {
+			if file.Status == StatusFailed {
+				assert.Equal(t, filepath.Join(tempCwd, "apps", "api", ".env"), normalizePath(file.Destination))
+				assert.ErrorContains(t, file.Err, "permission denied")
+			}
+		}
+	}
+	assert.FileExists(t, filepath.Join(tempCwd, "apps", "web", ".env"))
+}
+
+func TestPlanCopyToProject_Subdirectory(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env", "apps/api/.env", "apps/web/.env", "apps/web/config/.env.local")
+	root := t.TempDir()
+
+	plan, err := PlanCopyToProject(CopyOptions{Project: "web", VaultDir: vaultDir, Root: root, CurrentPath: filepath.Join("apps", "web")})
 	assert.NoError(t, err)
-	w.Close()
-	os.Stdin = r
-	defer func() { os.Stdin = origStdin }()
+	assert.Equal(t, filepath.Join(root, "apps", "web"), plan.Destination)
+
+	var destinations []string
+	for _, entry := range plan.Entries {
+		assert.Equal(t, ActionCreate, entry.Action)
+		destinations = append(destinations, entry.Destination)
+	}
+	assert.ElementsMatch(t, []string{
+		filepath.Join(root, "apps", "web", ".env"),
+		filepath.Join(root, "apps", "web", "config", ".env.local"),
+	}, destinations, "Expected only the files of the subdirectory, below the root")
+}
+
+func TestPlanCopyToProject_SubdirectoryNotInVault(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env")
+
+	plan, err := PlanCopyToProject(CopyOptions{Project: "web", VaultDir: vaultDir, Root: t.TempDir(), CurrentPath: filepath.Join("apps", "docs")})
+	assert.NoError(t, err, "Expected a subdirectory without env files to plan nothing")
+	assert.Empty(t, plan.Entries)
+}
+
+func TestPlanCopyToProject_SubdirectoryFiles(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", "apps/web/.env", "apps/web/.env.local")
+	root := t.TempDir()
+
+	plan, err := PlanCopyToProject(CopyOptions{
+		Project:     "web",
+		VaultDir:    vaultDir,
+		Root:        root,
+		CurrentPath: filepath.Join("apps", "web"),
+		Files:       []ProjectFile{{Path: "apps/*/.env"}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, plan.Entries, 1, "Expected the config paths to stay relative to the root") {
+		assert.Equal(t, filepath.Join(root, "apps", "web", ".env"), plan.Entries[0].Destination)
+	}
+}
+
+func TestHandleExistingFile_NotOverwrite(t *testing.T) {
+	tempDir := t.TempDir()
+	// Simulate user input "n" so that the file is not overwritten.
+	opts := CopyOptions{VaultDir: tempDir, Overwrite: OverwritePrompt, Input: strings.NewReader("n\n")}
 	var called bool
 	origCopySpinner := copyFileWithSpinnerFunc
 	defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
-	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, vaultDir string) error {
+	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
 		called = true
 		return nil
 	}
-	err = handleExistingFile("dummySource", "dummyDest", tempDir)
+	_, err := handleExistingFile(context.Background(), "dummySource", "dummyDest", opts)
 	assert.NoError(t, err)
 	assert.False(t, called)
 }
@@ -400,36 +631,199 @@ func TestHandleExistingFile_NotOverwrite(t *testing.T) {
 func TestHandleExistingFile_Overwrite(t *testing.T) {
 	tempDir := t.TempDir()
 	// Simulate user input "y" so that the file is overwritten.
-	origStdin := os.Stdin
-	r, w, err := os.Pipe()
-	assert.NoError(t, err)
-	_, err = w.WriteString("y\n")
-	assert.NoError(t, err)
-	w.Close()
-	os.Stdin = r
-	defer func() { os.Stdin = origStdin }()
+	opts := CopyOptions{VaultDir: tempDir, Overwrite: OverwritePrompt, Input: strings.NewReader("y\n")}
 	var called bool
 	origCopySpinner := copyFileWithSpinnerFunc
 	defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
-	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, vaultDir string) error {
+	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
 		called = true
 		return nil
 	}
-	err = handleExistingFile("dummySource", "dummyDest", tempDir)
+	_, err := handleExistingFile(context.Background(), "dummySource", "dummyDest", opts)
 	assert.NoError(t, err)
 	assert.True(t, called, "Expected copy function to be called when user confirms overwrite")
 }
 
+func TestHandleExistingFile_OverwriteModes(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       OverwriteMode
+		input      string
+		wantCalled bool
+	}{
+		{name: "Always", mode: OverwriteAlways, wantCalled: true},
+		{name: "Never", mode: OverwriteNever, wantCalled: false},
+		{name: "PromptWithoutNewline", mode: OverwritePrompt, input: "y", wantCalled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			origCopySpinner := copyFileWithSpinnerFunc
+			defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
+			copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
+				called = true
+				return nil
+			}
+			// Non-prompt modes must never touch the input.
+			opts := CopyOptions{VaultDir: t.TempDir(), Overwrite: tt.mode, Input: strings.NewReader(tt.input)}
+			_, err := handleExistingFile(context.Background(), "dummySource", "dummyDest", opts)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCalled, called)
+		})
+	}
+}
+
+func TestHandleExistingFile_PromptMerge(t *testing.T) {
+	var called bool
+	origMerge := mergeFileFunc
+	defer func() { mergeFileFunc = origMerge }()
+	mergeFileFunc = func(sourcePath, destinationPath string, opts CopyOptions) error {
+		called = true
+		return nil
+	}
+	opts := CopyOptions{VaultDir: t.TempDir(), Overwrite: OverwritePrompt, Input: strings.NewReader("m\n")}
+	_, err := handleExistingFile(context.Background(), "dummySource", "dummyDest", opts)
+	assert.NoError(t, err)
+	assert.True(t, called, "Expected merge function to be called when user chooses merge")
+}
+
+func TestHandleExistingFile_PromptNoInput(t *testing.T) {
+	opts := CopyOptions{VaultDir: t.TempDir(), Overwrite: OverwritePrompt, Input: strings.NewReader("")}
+	_, err := handleExistingFile(context.Background(), "dummySource", "dummyDest", opts)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read input")
+}
+
+func TestPlanCopyEnvFileToProject_Merge(t *testing.T) {
+	tempProject := t.TempDir()
+	tempCwd := t.TempDir()
+	vaultFile := filepath.Join(tempProject, ".env")
+	assert.NoError(t, os.WriteFile(vaultFile, []byte("API_KEY=new\nPORT=3000\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, ".env"), []byte("PORT=4000\nAPI_KEY=new\n"), 0644))
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	entry, err := planCopyEnvFileToProject(vaultFile, ".env", CopyOptions{VaultDir: tempProject, Overwrite: OverwriteMerge, Prefer: PreferVault})
+	assert.NoError(t, err)
+	assert.Equal(t, ActionMerge, entry.Action)
+
+	// Keeping local values leaves nothing to merge since every vault key already exists locally.
+	entry, err = planCopyEnvFileToProject(vaultFile, ".env", CopyOptions{VaultDir: tempProject, Overwrite: OverwriteMerge, Prefer: PreferLocal})
+	assert.NoError(t, err)
+	assert.Equal(t, ActionIdentical, entry.Action)
+}
+
+func TestMergeFile(t *testing.T) {
+	tempDir := t.TempDir()
+	source := filepath.Join(tempDir, "vault.env")
+	destination := filepath.Join(tempDir, ".env")
+	assert.NoError(t, os.WriteFile(source, []byte("API_KEY=new\nNEW_SECRET=abc\n"), 0644))
+	assert.NoError(t, os.WriteFile(destination, []byte("# local\nPORT=4000\nAPI_KEY=old\n"), 0600))
+
+	err := mergeFile(source, destination, CopyOptions{VaultDir: tempDir, Prefer: PreferVault})
+	assert.NoError(t, err)
+	data, err := os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, "# local\nPORT=4000\nAPI_KEY=new\n\nNEW_SECRET=abc\n", string(data))
+
+	info, err := os.Stat(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Expected merge to write the default file mode")
+}
+
+func TestMergeFile_ParseError(t *testing.T) {
+	tempDir := t.TempDir()
+	source := filepath.Join(tempDir, "vault.env")
+	destination := filepath.Join(tempDir, ".env")
+	assert.NoError(t, os.WriteFile(source, []byte("NOT VALID\n"), 0644))
+	assert.NoError(t, os.WriteFile(destination, []byte("A=1\n"), 0644))
+
+	err := mergeFile(source, destination, CopyOptions{VaultDir: tempDir})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot merge")
+	data, err := os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, "A=1\n", string(data), "Expected destination to be untouched")
+}
+
 // ---------------------------
-// Tests for ConfirmCwd
+// Tests for ParseOverwriteMode and ProjectExists
 // ---------------------------
 
-func TestConfirmCwd_Success(t *testing.T) {
-	// Set working directory to a temporary directory.
+func TestParseOverwriteMode(t *testing.T) {
+	for input, want := range map[string]OverwriteMode{
+		"":        OverwritePrompt,
+		"prompt":  OverwritePrompt,
+		"ALWAYS":  OverwriteAlways,
+		" never ": OverwriteNever,
+		"merge":   OverwriteMerge,
+	} {
+		got, err := ParseOverwriteMode(input)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := ParseOverwriteMode("sometimes")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid overwrite mode")
+}
+
+func TestParseMergePreference(t *testing.T) {
+	for input, want := range map[string]MergePreference{
+		"":      PreferVault,
+		"vault": PreferVault,
+		"Local": PreferLocal,
+	} {
+		got, err := ParseMergePreference(input)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := ParseMergePreference("remote")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid merge preference")
+}
+
+func TestProjectExists(t *testing.T) {
+	tempDir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(tempDir, "proj"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, "file.env"), []byte("A=1"), 0644))
+
+	exists, err := ProjectExists(tempDir, "proj")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = ProjectExists(tempDir, "missing")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = ProjectExists(tempDir, "file.env")
+	assert.NoError(t, err)
+	assert.False(t, exists, "Expected a regular file not to count as a project")
+
+	exists, err = ProjectExists(tempDir, "")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+// ---------------------------
+// Tests for ConfirmRoot
+// ---------------------------
+
+func TestConfirmRoot_Success(t *testing.T) {
+	// Confirm the working directory, as backups without --root do outside of a repository.
 	tempDir := t.TempDir()
 	origWd, _ := utils.GetWdFunc()
 	os.Chdir(tempDir)
 	defer os.Chdir(origWd)
+	root, err := FindProjectRoot(utils.GetCurrentWorkingDirectory(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, RootWorkingDirectory, root.Source)
 	origStdin := os.Stdin
 	r, w, err := os.Pipe()
 	assert.NoError(t, err)
@@ -438,11 +832,11 @@ func TestConfirmCwd_Success(t *testing.T) {
 	w.Close()
 	os.Stdin = r
 	defer func() { os.Stdin = origStdin }()
-	err = ConfirmCwd()
+	err = ConfirmRoot(context.Background(), root)
 	assert.NoError(t, err)
 }
 
-func TestConfirmCwd_Abort(t *testing.T) {
+func TestConfirmRoot_Abort(t *testing.T) {
 	origExit := exitFunc
 	var exitCode int
 	exitFunc = func(code int) {
@@ -454,6 +848,8 @@ func TestConfirmCwd_Abort(t *testing.T) {
 	origWd, _ := utils.GetWdFunc()
 	os.Chdir(tempDir)
 	defer os.Chdir(origWd)
+	root, err := FindProjectRoot(utils.GetCurrentWorkingDirectory(), nil)
+	assert.NoError(t, err)
 	origStdin := os.Stdin
 	r, w, err := os.Pipe()
 	assert.NoError(t, err)
@@ -462,7 +858,7 @@ func TestConfirmCwd_Abort(t *testing.T) {
 	w.Close()
 	os.Stdin = r
 	defer func() { os.Stdin = origStdin }()
-	assert.Panics(t, func() { ConfirmCwd() })
+	assert.Panics(t, func() { ConfirmRoot(context.Background(), root) })
 	assert.Equal(t, 0, exitCode)
 }
 
@@ -473,12 +869,12 @@ func TestConfirmCwd_Abort(t *testing.T) {
 func TestCopyEnvFilesToVault_Error(t *testing.T) {
 	// Use a temporary vault directory to avoid creating a "vaultDir" in the real project.
 	tempVault := t.TempDir()
-	origReadDir := utils.ReadDirRecursiveFunc
-	defer func() { utils.ReadDirRecursiveFunc = origReadDir }()
-	utils.ReadDirRecursiveFunc = func(dirPath string) ([]string, error) {
+	origReadDir := utils.ReadDirPrunedFunc
+	defer func() { utils.ReadDirPrunedFunc = origReadDir }()
+	utils.ReadDirPrunedFunc = func(dirPath string, opts utils.PruneOptions) ([]string, error) {
 		return nil, fmt.Errorf("failed to read directory recursively: simulated error")
 	}
-	err := CopyEnvFilesToVault(tempVault)
+	_, err := CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: tempVault})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "error reading project path")
 }
@@ -494,23 +890,14 @@ func TestCopyEnvFilesToVault_WithTempVault(t *testing.T) {
 	err := os.WriteFile(dummyFile, []byte("content"), 0644)
 	assert.NoError(t, err)
 
-	// Override utils.ReadDirRecursiveFunc to simulate reading the dummy file.
-	origReadDir := utils.ReadDirRecursiveFunc
-	defer func() { utils.ReadDirRecursiveFunc = origReadDir }()
-	utils.ReadDirRecursiveFunc = func(dirPath string) ([]string, error) {
+	// Override utils.ReadDirPrunedFunc to simulate reading the dummy file.
+	origReadDir := utils.ReadDirPrunedFunc
+	defer func() { utils.ReadDirPrunedFunc = origReadDir }()
+	utils.ReadDirPrunedFunc = func(dirPath string, opts utils.PruneOptions) ([]string, error) {
 		// Assume that the current project directory is used.
 		return []string{dummyFile}, nil
 	}
 
-	// Override copyFileWithSpinnerFunc to record that it was called.
-	var called bool
-	origCopySpinner := copyFileWithSpinnerFunc
-	defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
-	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, vaultDir string) error {
-		called = true
-		return nil
-	}
-
 	// Simulate that the current working directory is the temporary project directory.
 	origWd, err := utils.GetWdFunc()
 	assert.NoError(t, err)
@@ -522,51 +909,438 @@ func TestCopyEnvFilesToVault_WithTempVault(t *testing.T) {
 	}()
 
 	// Call CopyEnvFilesToVault with the temporary vault directory.
-	err = CopyEnvFilesToVault(tempVaultDir)
+	_, err = CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: tempVaultDir})
 	assert.NoError(t, err)
-	assert.True(t, called, "Expected copyFileWithSpinnerFunc to be called")
 
-	// Verify that a backup folder was created in the vault.
+	// Verify that a timestamped backup folder was created under the project in the backups directory.
 	projectBase := filepath.Base(tempProjectDir)
+	entries, err := os.ReadDir(filepath.Join(tempVaultDir, ".backups", projectBase))
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		_, err = utils.ParseBackupTimestamp(entries[0].Name())
+		assert.NoError(t, err, "Expected the backup folder to be named after the timestamp")
+
+		manifest, ok, err := ReadManifest(filepath.Join(tempVaultDir, ".backups", projectBase, entries[0].Name()))
+		assert.NoError(t, err)
+		assert.True(t, ok, "Expected the backup to be stored as a manifest")
+		if assert.Len(t, manifest.Files, 1) {
+			assert.Equal(t, "config.env", manifest.Files[0].Path)
+			assert.FileExists(t, ObjectPath(tempVaultDir, manifest.Files[0].Hash))
+		}
+	}
+
+	rootEntries, err := os.ReadDir(tempVaultDir)
+	assert.NoError(t, err)
+	var names []string
+	for _, entry := range rootEntries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{".backups", ".objects"}, names, "Expected only cpenv's own directories in the vault root")
+}
+
+func TestPlanCopyToVault_Root(t *testing.T) {
+	vaultDir := t.TempDir()
+	root := filepath.Join(t.TempDir(), "app")
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "apps", "web"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ".env"), []byte("A=1\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "apps", "web", ".env"), []byte("B=2\n"), 0644))
+
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(filepath.Join(root, "apps", "web")))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	plan, err := PlanCopyToVault(BackupOptions{VaultDir: vaultDir, Root: root, Include: []string{"**/.env"}})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(BackupsDir(vaultDir), "app"), filepath.Dir(plan.Destination), "Expected the backup to be named after the root")
+
+	var destinations []string
+	for _, entry := range plan.Entries {
+		relativePath, err := filepath.Rel(plan.Destination, entry.Destination)
+		assert.NoError(t, err)
+		destinations = append(destinations, filepath.ToSlash(relativePath))
+	}
+	assert.ElementsMatch(t, []string{".env", "apps/web/.env"}, destinations, "Expected paths relative to the root, not the working directory")
+}
+
+func TestPlanCopyToVault_DoesNotWrite(t *testing.T) {
+	tempVaultDir := t.TempDir()
+	tempProjectDir := t.TempDir()
+	dummyFile := filepath.Join(tempProjectDir, "config.env")
+	assert.NoError(t, os.WriteFile(dummyFile, []byte("content"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tempProjectDir, "readme.txt"), []byte("content"), 0644))
+
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempProjectDir))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	plan, err := PlanCopyToVault(BackupOptions{VaultDir: tempVaultDir})
+	assert.NoError(t, err)
+	assert.Len(t, plan.Entries, 1)
+	assert.Equal(t, ActionCreate, plan.Entries[0].Action)
+	assert.Equal(t, filepath.Join(plan.Destination, "config.env"), plan.Entries[0].Destination)
+
 	entries, err := os.ReadDir(tempVaultDir)
 	assert.NoError(t, err)
-	found := false
-	for _, e := range entries {
-		if strings.HasPrefix(e.Name(), projectBase+"-") {
-			found = true
-			break
+	assert.Empty(t, entries, "Expected planning not to create anything in the vault")
+}
+
+func TestPlanCopyToVault_PrunesDirectories(t *testing.T) {
+	tempProjectDir := t.TempDir()
+	for _, rel := range []string{"config.env", "api/prod.env", "vendor/lib/x.env", "dist/build.env", "local.env"} {
+		path := filepath.Join(tempProjectDir, filepath.FromSlash(rel))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("A=1"), 0644))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(tempProjectDir, ".gitignore"), []byte("dist/\n*.env\n"), 0644))
+
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempProjectDir))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	plan, err := PlanCopyToVault(BackupOptions{VaultDir: t.TempDir(), Gitignore: true})
+	assert.NoError(t, err)
+	var sources []string
+	for _, entry := range plan.Entries {
+		rel, err := filepath.Rel(tempProjectDir, entry.Source)
+		assert.NoError(t, err)
+		sources = append(sources, filepath.ToSlash(rel))
+	}
+	assert.ElementsMatch(t, []string{"config.env", "api/prod.env", "local.env"}, sources, "Expected ignored env files to be kept and pruned directories to be skipped")
+
+	_, err = PlanCopyToVault(BackupOptions{VaultDir: t.TempDir(), Prune: []string{"[unclosed"}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid prune pattern")
+}
+
+func TestCopyEnvFilesToVault_SkipsUnchanged(t *testing.T) {
+	tempVaultDir := t.TempDir()
+	tempProjectDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(tempProjectDir, "api"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(tempProjectDir, "config.env"), []byte("A=1\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tempProjectDir, "api", "prod.env"), []byte("B=2\n"), 0644))
+
+	// An existing backup with the same contents.
+	latest := filepath.Join(tempVaultDir, ".backups", filepath.Base(tempProjectDir), "2024-05-01_10-00-00")
+	assert.NoError(t, os.MkdirAll(filepath.Join(latest, "api"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(latest, "config.env"), []byte("A=1\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(latest, "api", "prod.env"), []byte("B=2\n"), 0644))
+
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempProjectDir))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	backupCount := func() int {
+		entries, err := os.ReadDir(filepath.Dir(latest))
+		assert.NoError(t, err)
+		return len(entries)
+	}
+
+	plan, err := PlanCopyToVault(BackupOptions{VaultDir: tempVaultDir})
+	assert.NoError(t, err)
+	assert.Equal(t, latest, plan.Destination)
+	assert.Equal(t, 2, plan.Count(ActionIdentical))
+
+	_, err = CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: tempVaultDir})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, backupCount(), "Expected no new backup when nothing changed")
+
+	plan, err = PlanCopyToVault(BackupOptions{VaultDir: tempVaultDir, Force: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, plan.Count(ActionCreate), "Expected --force to plan a new backup")
+
+	// A changed file creates a new backup.
+	assert.NoError(t, os.WriteFile(filepath.Join(tempProjectDir, "api", "prod.env"), []byte("B=3\n"), 0644))
+	plan, err = PlanCopyToVault(BackupOptions{VaultDir: tempVaultDir})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, plan.Count(ActionCreate))
+	_, err = CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: tempVaultDir})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, backupCount())
+
+	// So does a file that was added since the latest backup.
+	assert.NoError(t, os.RemoveAll(filepath.Dir(latest)))
+	assert.NoError(t, os.MkdirAll(latest, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(latest, "config.env"), []byte("A=1\n"), 0644))
+	plan, err = PlanCopyToVault(BackupOptions{VaultDir: tempVaultDir})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, plan.Count(ActionCreate))
+}
+
+func TestPlanCopyEnvFileToVault_SkipCases(t *testing.T) {
+	// Test branches that should skip copying with the default patterns.
+	opts := BackupOptions{}.withDefaults()
+	for _, file := range []string{
+		"dummyCwd/node_modules/somefile.env",
+		"dummyCwd/apps/web/node_modules/pkg/.env",
+		"dummyCwd/config.template",
+		"dummyCwd/config.template.env",
+		"dummyCwd/config.example",
+		"dummyCwd/.env.example",
+		"dummyCwd/readme.txt",
+		"outside/.env",
+	} {
+		_, ok := planCopyEnvFileToVault(file, "dummyCwd", "dummyDest", opts)
+		assert.False(t, ok, "Expected %s to be skipped", file)
+	}
+
+	for _, file := range []string{"dummyCwd/.env", "dummyCwd/apps/api/prod.env"} {
+		_, ok := planCopyEnvFileToVault(file, "dummyCwd", "dummyDest", opts)
+		assert.True(t, ok, "Expected %s to be backed up", file)
+	}
+}
+
+func TestPlanCopyEnvFileToVault_CustomPatterns(t *testing.T) {
+	opts := BackupOptions{
+		Include: []string{"**/.env", "**/.env.*", "**/.envrc", "**/secrets.env.json"},
+		Exclude: []string{"**/.env.example", "legacy/**"},
+	}
+	for file, want := range map[string]bool{
+		"dummyCwd/.env":                      true,
+		"dummyCwd/.env.local":                true,
+		"dummyCwd/apps/web/.env.development": true,
+		"dummyCwd/.envrc":                    true,
+		"dummyCwd/config/secrets.env.json":   true,
+		"dummyCwd/.env.example":              false,
+		"dummyCwd/legacy/.env":               false,
+		"dummyCwd/prod.env":                  false,
+	} {
+		entry, ok := planCopyEnvFileToVault(file, "dummyCwd", "dummyDest", opts)
+		assert.Equal(t, want, ok, file)
+		if ok {
+			rel, _ := filepath.Rel("dummyCwd", file)
+			assert.Equal(t, filepath.Join("dummyDest", rel), entry.Destination)
 		}
 	}
-	assert.True(t, found, "Expected a backup folder starting with the project name in the vault")
+}
+
+func TestPlanCopyToVault_InvalidPattern(t *testing.T) {
+	_, err := PlanCopyToVault(BackupOptions{VaultDir: t.TempDir(), Include: []string{"[unclosed"}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid include pattern")
+
+	_, err = PlanCopyToVault(BackupOptions{VaultDir: t.TempDir(), Exclude: []string{"[unclosed"}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid exclude pattern")
 }
 
 func TestProcessCopyEnvFileToVault_SkipCases(t *testing.T) {
-	tempDir := t.TempDir()
-	// Test branches that should skip copying.
-	err := processCopyEnvFileToVault("node_modules/somefile.env", "dummyCwd", "dummyDest", tempDir)
-	assert.NoError(t, err)
-	err = processCopyEnvFileToVault("dummyCwd/config.template", "dummyCwd", "dummyDest", tempDir)
+	tempVault := t.TempDir()
+	tempCwd := t.TempDir()
+	origWd, err := utils.GetWdFunc()
 	assert.NoError(t, err)
-	err = processCopyEnvFileToVault("dummyCwd/config.example", "dummyCwd", "dummyDest", tempDir)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	// Test branches that should skip copying, next to a file that is backed up.
+	files := []string{"node_modules/somefile.env", "config.template", "config.example", "readme.txt", "config.env"}
+	for _, file := range files {
+		path := filepath.Join(tempCwd, filepath.FromSlash(file))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("KEY=value\n"), 0644))
+	}
+	origReadDir := utils.ReadDirPrunedFunc
+	defer func() { utils.ReadDirPrunedFunc = origReadDir }()
+	utils.ReadDirPrunedFunc = func(dirPath string, opts utils.PruneOptions) ([]string, error) {
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, filepath.Join(dirPath, filepath.FromSlash(file)))
+		}
+		return paths, nil
+	}
+	results, err := CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: tempVault})
 	assert.NoError(t, err)
-	err = processCopyEnvFileToVault("dummyCwd/readme.txt", "dummyCwd", "dummyDest", tempDir)
+	assert.Len(t, results.Files, 1, "Expected skipped files not to be processed")
+	backups, err := ListBackups(tempVault)
 	assert.NoError(t, err)
+	if assert.Len(t, backups, 1) {
+		manifest, ok, err := ReadManifest(filepath.Join(tempVault, backups[0].Name))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		if assert.Len(t, manifest.Files, 1, "Expected skipped files not to be processed") {
+			assert.Equal(t, "config.env", manifest.Files[0].Path)
+		}
+	}
 }
 
 func TestProcessCopyEnvFileToVault_Copy(t *testing.T) {
-	tempDir := t.TempDir()
-	// Test the branch that actually copies an .env file.
+	tempVault := t.TempDir()
+	// Test the branch that stores an .env file in the object store.
 	tempCwd := t.TempDir()
-	dummyFile := filepath.Join(tempCwd, "config.env")
-	assert.NoError(t, os.WriteFile(dummyFile, []byte("content"), 0644))
-	var called bool
-	origCopySpinner := copyFileWithSpinnerFunc
-	defer func() { copyFileWithSpinnerFunc = origCopySpinner }()
-	copyFileWithSpinnerFunc = func(sourcePath, destinationPath string, vaultDir string) error {
-		called = true
-		return nil
+	dummyFile := filepath.Join(tempCwd, "apps", "config.env")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(dummyFile), 0755))
+	assert.NoError(t, os.WriteFile(dummyFile, []byte("content"), 0640))
+	backupPath := filepath.Join(tempVault, ".backups", "project", "2024-05-01_10-00-00")
+
+	entry, ok := planCopyEnvFileToVault(dummyFile, tempCwd, backupPath, BackupOptions{}.withDefaults())
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(backupPath, "apps", "config.env"), entry.Destination)
+
+	manifestEntry, err := processCopyEnvFileToVault(entry, backupPath, tempVault, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "apps/config.env", manifestEntry.Path)
+	assert.Equal(t, os.FileMode(0640), manifestEntry.Mode)
+
+	stored, err := os.ReadFile(ObjectPath(tempVault, manifestEntry.Hash))
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(stored))
+	assert.NoFileExists(t, entry.Destination, "Expected the backup to reference the object instead of a copy")
+}
+
+func TestCopyEnvFilesToProject_Canceled(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env")
+
+	tempCwd := t.TempDir()
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = CopyEnvFilesToProject(ctx, CopyOptions{Project: "web", VaultDir: vaultDir})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoFileExists(t, filepath.Join(tempCwd, ".env"))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, "app.env"), []byte("KEY=value\n"), 0644))
+	_, err = CopyEnvFilesToVault(ctx, BackupOptions{VaultDir: vaultDir})
+	assert.ErrorIs(t, err, context.Canceled)
+	backups, err := ListBackups(vaultDir)
+	assert.NoError(t, err)
+	assert.Empty(t, backups, "Expected an interrupted backup not to leave a snapshot")
+}
+
+func TestCopyEnvFilesToVault_SameSecond(t *testing.T) {
+	tempVaultDir := t.TempDir()
+	tempProjectDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(tempProjectDir, "config.env"), []byte("A=1\n"), 0644))
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempProjectDir))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+	origTimestamp := backupTimestampFunc
+	defer func() { backupTimestampFunc = origTimestamp }()
+	backupTimestampFunc = func() string { return "2024-05-01_10-00-00" }
+
+	// Two backups within the same second keep both manifests.
+	_, err = CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: tempVaultDir})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(tempProjectDir, "config.env"), []byte("A=2\n"), 0644))
+	_, err = CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: tempVaultDir})
+	assert.NoError(t, err)
+
+	backups, err := ListBackups(tempVaultDir)
+	assert.NoError(t, err)
+	project := filepath.Base(tempProjectDir)
+	if assert.Len(t, backups, 2) {
+		assert.Equal(t, filepath.Join(".backups", project, "2024-05-01_10-00-00-2"), backups[0].Name, "Expected the second backup to be the latest")
+		assert.Equal(t, filepath.Join(".backups", project, "2024-05-01_10-00-00"), backups[1].Name)
+		assert.Equal(t, backups[0].Timestamp, backups[1].Timestamp)
 	}
-	err := processCopyEnvFileToVault(dummyFile, tempCwd, filepath.Join(tempCwd, "vault"), tempDir)
+
+	for name, want := range map[string]string{"2024-05-01_10-00-00": "A=1\n", "2024-05-01_10-00-00-2": "A=2\n"} {
+		manifest, ok, err := ReadManifest(filepath.Join(tempVaultDir, ".backups", project, name))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		if assert.Len(t, manifest.Files, 1) {
+			stored, err := os.ReadFile(ObjectPath(tempVaultDir, manifest.Files[0].Hash))
+			assert.NoError(t, err)
+			assert.Equal(t, want, string(stored), name)
+		}
+	}
+}
+
+func TestCopyEnvFilesToVault_AggregatesFailures(t *testing.T) {
+	tempVault := t.TempDir()
+	tempCwd := t.TempDir()
+	origWd, err := utils.GetWdFunc()
 	assert.NoError(t, err)
-	assert.True(t, called)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, "app.env"), []byte("KEY=value\n"), 0644))
+
+	// The listed file disappears before it is backed up.
+	origReadDir := utils.ReadDirPrunedFunc
+	defer func() { utils.ReadDirPrunedFunc = origReadDir }()
+	utils.ReadDirPrunedFunc = func(dirPath string, opts utils.PruneOptions) ([]string, error) {
+		return []string{filepath.Join(dirPath, "app.env"), filepath.Join(dirPath, "gone.env")}, nil
+	}
+
+	results, err := CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: tempVault})
+	assert.Error(t, err)
+	assert.Equal(t, 1, results.Count(StatusCreated))
+	assert.Equal(t, 1, results.Count(StatusFailed))
+
+	backups, err := ListBackups(tempVault)
+	assert.NoError(t, err)
+	assert.Empty(t, backups, "Expected an incomplete backup not to leave a snapshot")
+	assert.NoDirExists(t, filepath.Join(BackupsDir(tempVault), filepath.Base(tempCwd)))
+}
+
+func TestCopyEnvFilesToVault_UnreadableFile(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read files without read permission")
+	}
+	tempVault := t.TempDir()
+	tempCwd := t.TempDir()
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, ".env"), []byte("KEY=value\n"), 0644))
+	writeBackup(t, tempVault, filepath.Join(BackupsDirName, filepath.Base(tempCwd), "2024-05-01_10-00-00"), ".env")
+
+	unreadable := filepath.Join(tempCwd, "secret.env")
+	assert.NoError(t, os.WriteFile(unreadable, []byte("SECRET=value\n"), 0644))
+	assert.NoError(t, os.Chmod(unreadable, 0000))
+	defer os.Chmod(unreadable, 0644)
+
+	results, err := CopyEnvFilesToVault(context.Background(), BackupOptions{VaultDir: tempVault})
+	assert.Error(t, err)
+	assert.Equal(t, 1, results.Count(StatusFailed))
+
+	backups, err := ListBackups(tempVault)
+	assert.NoError(t, err)
+	if assert.Len(t, backups, 1, "Expected only the complete backup to be kept") {
+		assert.Equal(t, filepath.Join(BackupsDirName, filepath.Base(tempCwd), "2024-05-01_10-00-00"), backups[0].Name)
+	}
+	entries, err := os.ReadDir(filepath.Join(tempVault, BackupsDirName, filepath.Base(tempCwd)))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "Expected the folder of the failed backup to be removed")
+}
+
+func TestReadAnswer_Canceled(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	_, err := readAnswer(ctx, reader)
+	assert.ErrorIs(t, err, context.Canceled, "Expected a pending prompt to stop waiting on interrupt")
+
+	answer, err := readAnswer(context.Background(), strings.NewReader("y"))
+	assert.NoError(t, err)
+	assert.Equal(t, "y", answer)
 }
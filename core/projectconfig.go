@@ -0,0 +1,192 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// ProjectConfigFileName is the per-repository config binding a checkout to a vault project. It is meant to be
+// committed, so that every clone and worktree of the repository uses the same project.
+const ProjectConfigFileName = ".cpenv.yaml"
+
+// ProjectFile is an env file managed through the project config.
+type ProjectFile struct {
+	// Path is a doublestar glob relative to the directory of the project config, e.g. apps/*/.env.
+	Path string
+	// Overwrite is what copy does when the file exists. It is empty to use the mode of the command.
+	Overwrite OverwriteMode
+}
+
+// ProjectConfig is a parsed .cpenv.yaml:
+//
+//	project: web
+//	files:
+//	  - .env
+//	  - path: apps/*/.env
+//	    overwrite: merge
+type ProjectConfig struct {
+	// Project is the vault project of the repository.
+	Project string
+	// Files limits copy and backup to these files. Every env file is managed when it is empty.
+	Files []ProjectFile
+	// Path is where the config was read from.
+	Path string
+}
+
+// Dir returns the directory holding the project config; file paths are relative to it.
+func (c ProjectConfig) Dir() string {
+	return filepath.Dir(c.Path)
+}
+
+// Patterns returns the globs of the managed files.
+func (c ProjectConfig) Patterns() []string {
+	patterns := make([]string, 0, len(c.Files))
+	for _, file := range c.Files {
+		patterns = append(patterns, file.Path)
+	}
+	return patterns
+}
+
+// WithoutOverwrite returns the files with their overwrite policy cleared, for commands given an explicit mode.
+func (c ProjectConfig) WithoutOverwrite() []ProjectFile {
+	files := make([]ProjectFile, len(c.Files))
+	for i, file := range c.Files {
+		files[i] = ProjectFile{Path: file.Path}
+	}
+	return files
+}
+
+// matchProjectFile returns the first file whose pattern matches the slash-separated relative path.
+func matchProjectFile(files []ProjectFile, relativePath string) (ProjectFile, bool) {
+	for _, file := range files {
+		if utils.MatchAny([]string{file.Path}, relativePath) {
+			return file, true
+		}
+	}
+	return ProjectFile{}, false
+}
+
+// FindProjectConfig looks for a project config in dir and its parents, up to the root of the git repository
+// dir is in. Outside of a repository only dir itself is searched.
+func FindProjectConfig(dir string) (ProjectConfig, bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ProjectConfig{}, false, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	candidates := []string{dir}
+	if root, ok := findRepositoryRoot(dir); ok {
+		candidates = nil
+		for current := dir; ; current = filepath.Dir(current) {
+			candidates = append(candidates, current)
+			if current == root {
+				break
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		path := filepath.Join(candidate, ProjectConfigFileName)
+		if _, err := os.Stat(path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return ProjectConfig{}, false, fmt.Errorf("failed to check %s: %w", path, err)
+		}
+		config, err := LoadProjectConfig(path)
+		if err != nil {
+			return ProjectConfig{}, false, err
+		}
+		logrus.Debugf("Using project config: %s", path)
+		return config, true, nil
+	}
+	logrus.Debugf("No project config found from %s", dir)
+	return ProjectConfig{}, false, nil
+}
+
+// findRepositoryRoot returns the closest directory from dir upwards holding .git, which is a directory in a
+// clone and a file in a linked worktree.
+func findRepositoryRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectConfig reads and validates a project config.
+func LoadProjectConfig(path string) (ProjectConfig, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return ProjectConfig{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	config := ProjectConfig{Project: strings.TrimSpace(v.GetString("project")), Path: path}
+	if strings.ContainsAny(config.Project, `/\`) || strings.HasPrefix(config.Project, ".") {
+		return ProjectConfig{}, fmt.Errorf("invalid project %q in %s", config.Project, path)
+	}
+
+	files, err := parseProjectFiles(v.Get("files"))
+	if err != nil {
+		return ProjectConfig{}, fmt.Errorf("invalid files in %s: %w", path, err)
+	}
+	config.Files = files
+	return config, nil
+}
+
+// parseProjectFiles parses the files of the project config. An entry is either a path or a map with path
+// and overwrite.
+func parseProjectFiles(value interface{}) ([]ProjectFile, error) {
+	if value == nil {
+		return nil, nil
+	}
+	entries, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %v", value)
+	}
+
+	var files []ProjectFile
+	for _, entry := range entries {
+		var file ProjectFile
+		switch e := entry.(type) {
+		case string:
+			file.Path = e
+		case map[string]interface{}:
+			file.Path, _ = e["path"].(string)
+			if overwrite, ok := e["overwrite"]; ok && overwrite != nil {
+				mode, err := ParseOverwriteMode(fmt.Sprint(overwrite))
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", file.Path, err)
+				}
+				file.Overwrite = mode
+			}
+		default:
+			return nil, fmt.Errorf("expected a path or a map with path and overwrite, got %v", entry)
+		}
+
+		file.Path = filepath.ToSlash(strings.TrimPrefix(strings.TrimSpace(file.Path), "./"))
+		if file.Path == "" {
+			return nil, fmt.Errorf("a file has no path")
+		}
+		if err := utils.ValidatePatterns([]string{file.Path}); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
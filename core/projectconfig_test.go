@@ -0,0 +1,155 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+func writeProjectConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, ProjectConfigFileName)
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadProjectConfig(t *testing.T) {
+	path := writeProjectConfig(t, t.TempDir(), `project: web
+files:
+  - .env
+  - ./apps/web/.env
+  - path: apps/*/.env.local
+    overwrite: merge
+`)
+
+	config, err := LoadProjectConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "web", config.Project)
+	assert.Equal(t, filepath.Dir(path), config.Dir())
+	assert.Equal(t, []ProjectFile{
+		{Path: ".env"},
+		{Path: "apps/web/.env"},
+		{Path: "apps/*/.env.local", Overwrite: OverwriteMerge},
+	}, config.Files)
+	assert.Equal(t, []string{".env", "apps/web/.env", "apps/*/.env.local"}, config.Patterns())
+	assert.Equal(t, ProjectFile{Path: "apps/*/.env.local"}, config.WithoutOverwrite()[2])
+
+	file, ok := matchProjectFile(config.Files, "apps/api/.env.local")
+	assert.True(t, ok)
+	assert.Equal(t, OverwriteMerge, file.Overwrite)
+	_, ok = matchProjectFile(config.Files, "apps/api/.env")
+	assert.False(t, ok)
+
+	for name, content := range map[string]string{
+		"overwrite": "files:\n  - path: .env\n    overwrite: sometimes\n",
+		"no path":   "files:\n  - overwrite: merge\n",
+		"not list":  "files: .env\n",
+		"pattern":   "files:\n  - \"apps/[web\"\n",
+		"project":   "project: ../web\n",
+	} {
+		_, err := LoadProjectConfig(writeProjectConfig(t, t.TempDir(), content))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestFindProjectConfig(t *testing.T) {
+	base := t.TempDir()
+	repo := filepath.Join(base, "repo")
+	subDir := filepath.Join(repo, "apps", "web")
+	assert.NoError(t, os.MkdirAll(subDir, 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, ".git"), 0755))
+
+	// A config above the repository root is not used.
+	writeProjectConfig(t, base, "project: outside\n")
+	_, ok, err := FindProjectConfig(subDir)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	path := writeProjectConfig(t, repo, "project: web\n")
+	config, ok, err := FindProjectConfig(subDir)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "web", config.Project)
+	assert.Equal(t, path, config.Path)
+
+	// Linked worktrees have a .git file instead of a directory.
+	worktree := filepath.Join(base, "worktree")
+	assert.NoError(t, os.MkdirAll(filepath.Join(worktree, "apps"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: "+filepath.Join(repo, ".git", "worktrees", "worktree")+"\n"), 0644))
+	writeProjectConfig(t, worktree, "project: web\n")
+	config, ok, err = FindProjectConfig(filepath.Join(worktree, "apps"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "web", config.Project)
+
+	// Outside of a repository only the directory itself is searched.
+	plain := filepath.Join(t.TempDir(), "plain")
+	writeProjectConfig(t, plain, "project: plain\n")
+	config, ok, err = FindProjectConfig(plain)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "plain", config.Project)
+	_, ok, err = FindProjectConfig(t.TempDir())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	writeProjectConfig(t, repo, "files: .env\n")
+	_, _, err = FindProjectConfig(subDir)
+	assert.Error(t, err, "Expected an invalid config to be reported")
+}
+
+func TestPlanCopyToProject_ManagedFiles(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "web", ".env", ".env.local", "apps/api/.env")
+
+	tempCwd := t.TempDir()
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, ".env"), []byte("KEY=local\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(tempCwd, "apps", "api"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, "apps", "api", ".env"), []byte("KEY=local\n"), 0644))
+
+	plan, err := PlanCopyToProject(CopyOptions{
+		Project:   "web",
+		VaultDir:  vaultDir,
+		Overwrite: OverwriteAlways,
+		Files:     []ProjectFile{{Path: ".env", Overwrite: OverwriteNever}, {Path: "apps/**/.env"}},
+	})
+	assert.NoError(t, err)
+
+	actions := map[string]PlanAction{}
+	for _, entry := range plan.Entries {
+		relativePath, err := filepath.Rel(plan.Destination, entry.Destination)
+		assert.NoError(t, err)
+		actions[filepath.ToSlash(relativePath)] = entry.Action
+	}
+	assert.Equal(t, map[string]PlanAction{
+		".env":          ActionSkip,
+		"apps/api/.env": ActionOverwrite,
+	}, actions, "Expected unlisted files to be left out and per-path overwrite modes to win")
+}
+
+func TestPlanCopyToVault_Project(t *testing.T) {
+	tempVault := t.TempDir()
+	tempCwd := filepath.Join(t.TempDir(), "feature-x")
+	assert.NoError(t, os.MkdirAll(tempCwd, 0755))
+	origWd, err := utils.GetWdFunc()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tempCwd))
+	defer func() {
+		assert.NoError(t, os.Chdir(origWd))
+	}()
+	assert.NoError(t, os.WriteFile(filepath.Join(tempCwd, "app.env"), []byte("KEY=value\n"), 0644))
+
+	plan, err := PlanCopyToVault(BackupOptions{VaultDir: tempVault, Project: "web"})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(BackupsDir(tempVault), "web"), filepath.Dir(plan.Destination), "Expected backups to be named after the configured project")
+}
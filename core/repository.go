@@ -0,0 +1,185 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Repository is the git checkout a directory belongs to, read from the files below .git without running git.
+type Repository struct {
+	// Root is the top-level directory of the checkout.
+	Root string
+	// GitDir is .git in a clone, or the directory named by the gitdir: line of .git in a linked worktree.
+	GitDir string
+	// CommonDir is the git directory shared by every worktree of the repository.
+	CommonDir string
+	// Worktree reports whether Root is a linked worktree rather than the main checkout.
+	Worktree bool
+	// OriginURL is the url of the origin remote, empty when there is none.
+	OriginURL string
+}
+
+// DetectRepository reads the git checkout dir belongs to. It reports false when dir is not in a checkout.
+func DetectRepository(dir string) (Repository, bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return Repository{}, false, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	root, ok := findRepositoryRoot(dir)
+	if !ok {
+		return Repository{}, false, nil
+	}
+
+	repo := Repository{Root: root, GitDir: filepath.Join(root, ".git")}
+	info, err := os.Stat(repo.GitDir)
+	if err != nil {
+		return Repository{}, false, fmt.Errorf("failed to read %s: %w", repo.GitDir, err)
+	}
+	if !info.IsDir() {
+		if repo.GitDir, err = readGitDirFile(repo.GitDir); err != nil {
+			return Repository{}, false, err
+		}
+		repo.Worktree = true
+	}
+
+	repo.CommonDir = repo.GitDir
+	if data, err := os.ReadFile(filepath.Join(repo.GitDir, "commondir")); err == nil {
+		repo.CommonDir = resolveGitPath(repo.GitDir, strings.TrimSpace(string(data)))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return Repository{}, false, fmt.Errorf("failed to read commondir: %w", err)
+	}
+
+	if repo.OriginURL, err = readOriginURL(filepath.Join(repo.CommonDir, "config")); err != nil {
+		return Repository{}, false, err
+	}
+	logrus.Debugf("Detected repository: root: %s, common dir: %s, worktree: %t, origin: %s", repo.Root, repo.CommonDir, repo.Worktree, repo.OriginURL)
+	return repo, true, nil
+}
+
+// readGitDirFile returns the git directory named by the "gitdir: <path>" line of a .git file.
+func readGitDirFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("%s has no gitdir line", path)
+	}
+	return resolveGitPath(filepath.Dir(path), strings.TrimSpace(gitDir)), nil
+}
+
+func resolveGitPath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
+
+// readOriginURL returns the url of the origin remote from a git config file.
+func readOriginURL(configPath string) (string, error) {
+	file, err := os.Open(configPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read git config: %w", err)
+	}
+	defer file.Close()
+
+	inOrigin := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			// Section headers look like [remote "origin"].
+			fields := strings.Fields(strings.Trim(line, "[]"))
+			inOrigin = len(fields) == 2 && strings.EqualFold(fields[0], "remote") && strings.Trim(fields[1], `"`) == "origin"
+			continue
+		}
+		if !inOrigin {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && strings.EqualFold(strings.TrimSpace(key), "url") {
+			return strings.Trim(strings.TrimSpace(value), `"`), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read git config: %w", err)
+	}
+	return "", nil
+}
+
+// RepoNameFromURL returns the repository name of a remote url, e.g. app for git@github.com:org/app.git.
+func RepoNameFromURL(url string) string {
+	url = strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+	if i := strings.LastIndexAny(url, "/:"); i >= 0 {
+		url = url[i+1:]
+	}
+	return url
+}
+
+// Names returns the names the repository may have in the vault, most specific first: the name of the origin
+// repository, the folder of the main checkout and the folder of this checkout.
+func (r Repository) Names() []string {
+	var names []string
+	add := func(name string) {
+		if name == "" || name == "." || name == string(filepath.Separator) {
+			return
+		}
+		for _, existing := range names {
+			if existing == name {
+				return
+			}
+		}
+		names = append(names, name)
+	}
+
+	add(RepoNameFromURL(r.OriginURL))
+	// The common dir is .git inside the main checkout, or the repository itself when it is bare.
+	if filepath.Base(r.CommonDir) == ".git" {
+		add(filepath.Base(filepath.Dir(r.CommonDir)))
+	} else {
+		add(strings.TrimSuffix(filepath.Base(r.CommonDir), ".git"))
+	}
+	add(filepath.Base(r.Root))
+	return names
+}
+
+// Name returns the most specific name of the repository.
+func (r Repository) Name() string {
+	names := r.Names()
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// DetectProject returns the first name of the repository dir belongs to that is a project of the vault.
+func DetectProject(vaultDir, dir string) (string, bool, error) {
+	repo, ok, err := DetectRepository(dir)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	for _, name := range repo.Names() {
+		exists, err := ProjectExists(vaultDir, name)
+		if err != nil {
+			return "", false, err
+		}
+		if exists && !strings.HasPrefix(name, ".") {
+			logrus.Debugf("Detected vault project %s for %s", name, repo.Root)
+			return name, true, nil
+		}
+	}
+	return "", false, nil
+}
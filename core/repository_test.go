@@ -0,0 +1,93 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoNameFromURL(t *testing.T) {
+	for url, want := range map[string]string{
+		"git@github.com:org/app.git":       "app",
+		"https://github.com/org/app":       "app",
+		"https://github.com/org/app/":      "app",
+		"ssh://git@host:22/org/app.git":    "app",
+		"/srv/git/app.git":                 "app",
+		"file:///srv/git/app":              "app",
+		"git@gitlab.com:group/sub/api.git": "api",
+		"":                                 "",
+	} {
+		assert.Equal(t, want, RepoNameFromURL(url), url)
+	}
+}
+
+func TestDetectRepository(t *testing.T) {
+	base := t.TempDir()
+	main := filepath.Join(base, "app2")
+	assert.NoError(t, os.MkdirAll(filepath.Join(main, ".git", "worktrees", "feature-x"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(main, "apps", "web"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(main, ".git", "config"), []byte(`[core]
+	bare = false
+[remote "upstream"]
+	url = git@github.com:someone/fork.git
+[remote "origin"]
+	url = git@github.com:org/app.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+`), 0644))
+
+	repo, ok, err := DetectRepository(filepath.Join(main, "apps", "web"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, main, repo.Root)
+	assert.False(t, repo.Worktree)
+	assert.Equal(t, "git@github.com:org/app.git", repo.OriginURL)
+	assert.Equal(t, []string{"app", "app2"}, repo.Names())
+	assert.Equal(t, "app", repo.Name())
+
+	// A linked worktree points to its git directory, which points back to the common directory.
+	worktree := filepath.Join(base, "feature-x")
+	assert.NoError(t, os.MkdirAll(worktree, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: ../app2/.git/worktrees/feature-x\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(main, ".git", "worktrees", "feature-x", "commondir"), []byte("../..\n"), 0644))
+
+	repo, ok, err = DetectRepository(worktree)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, repo.Worktree)
+	assert.Equal(t, filepath.Join(main, ".git"), repo.CommonDir)
+	assert.Equal(t, []string{"app", "app2", "feature-x"}, repo.Names())
+
+	// Without a remote, the folder of the main checkout comes first.
+	assert.NoError(t, os.Remove(filepath.Join(main, ".git", "config")))
+	repo, _, err = DetectRepository(worktree)
+	assert.NoError(t, err)
+	assert.Equal(t, "app2", repo.Name())
+
+	_, ok, err = DetectRepository(t.TempDir())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(worktree, ".git"), []byte("not a gitdir\n"), 0644))
+	_, _, err = DetectRepository(worktree)
+	assert.Error(t, err)
+}
+
+func TestDetectProject(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, "app2", ".env")
+
+	worktree := filepath.Join(t.TempDir(), "feature-x")
+	assert.NoError(t, os.MkdirAll(filepath.Join(worktree, ".git"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(worktree, ".git", "config"), []byte("[remote \"origin\"]\n\turl = https://github.com/org/app2.git\n"), 0644))
+
+	project, ok, err := DetectProject(vaultDir, worktree)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "app2", project)
+
+	_, ok, err = DetectProject(t.TempDir(), worktree)
+	assert.NoError(t, err)
+	assert.False(t, ok, "Expected no project when the vault has none of the names")
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// FileStatus is the outcome of copying, merging or backing up a single file.
+type FileStatus string
+
+const (
+	StatusCreated     FileStatus = "created"
+	StatusOverwritten FileStatus = "overwritten"
+	StatusMerged      FileStatus = "merged"
+	StatusSkipped     FileStatus = "skipped"
+	StatusUnchanged   FileStatus = "unchanged"
+	StatusFailed      FileStatus = "failed"
+)
+
+// resultStatuses is the order in which statuses are counted in the summary.
+var resultStatuses = []FileStatus{StatusCreated, StatusOverwritten, StatusMerged, StatusSkipped, StatusUnchanged, StatusFailed}
+
+// FileResult is the outcome of a single file. Err is set when Status is StatusFailed.
+type FileResult struct {
+	Source      string
+	Destination string
+	Status      FileStatus
+	Err         error
+}
+
+// Results collects the outcome of every file of a copy, restore or backup.
+type Results struct {
+	Files []FileResult
+}
+
+func (r *Results) add(entry PlanEntry, status FileStatus, err error) {
+	if err != nil {
+		status = StatusFailed
+	}
+	r.Files = append(r.Files, FileResult{Source: entry.Source, Destination: entry.Destination, Status: status, Err: err})
+}
+
+// Count returns how many files ended with the given status.
+func (r Results) Count(status FileStatus) int {
+	count := 0
+	for _, file := range r.Files {
+		if file.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Err returns an error when any file failed.
+func (r Results) Err() error {
+	if failed := r.Count(StatusFailed); failed > 0 {
+		return fmt.Errorf("%d of %d file(s) failed", failed, len(r.Files))
+	}
+	return nil
+}
+
+// PrintResults prints a table of every file and its status, followed by the count of each status.
+// Nothing is printed when there are no files.
+func PrintResults(w io.Writer, results Results, vaultDir string) {
+	if len(results.Files) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n%s %s\n", utils.InfoIcon(), utils.WhiteText("Summary:"))
+	for _, file := range results.Files {
+		path := utils.CyanText(prettifiedPath(file.Destination, vaultDir))
+		if file.Status == StatusFailed {
+			fmt.Fprintf(w, "  %s %s: %v\n", utils.RedText(fmt.Sprintf("%-11s", file.Status)), path, file.Err)
+			continue
+		}
+		fmt.Fprintf(w, "  %-11s %s\n", file.Status, path)
+	}
+
+	var counts []string
+	for _, status := range resultStatuses {
+		if count := results.Count(status); count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, status))
+		}
+	}
+	fmt.Fprintf(w, "\n%s\n", strings.Join(counts, ", "))
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResults(t *testing.T) {
+	var results Results
+	assert.NoError(t, results.Err())
+
+	results.add(PlanEntry{Source: "/vault/web/.env", Destination: "/elsewhere/.env"}, StatusCreated, nil)
+	results.add(PlanEntry{Source: "/vault/web/b.env", Destination: "/elsewhere/b.env"}, StatusOverwritten, errors.New("disk full"))
+	results.add(PlanEntry{Source: "/vault/web/c.env", Destination: "/elsewhere/c.env"}, StatusSkipped, nil)
+
+	assert.Equal(t, 1, results.Count(StatusCreated))
+	assert.Equal(t, 0, results.Count(StatusOverwritten), "Expected a file with an error to count as failed")
+	assert.Equal(t, 1, results.Count(StatusFailed))
+	assert.EqualError(t, results.Err(), "1 of 3 file(s) failed")
+
+	var buf bytes.Buffer
+	PrintResults(&buf, results, "/vault")
+	out := buf.String()
+	assert.Contains(t, out, "Summary:")
+	assert.Contains(t, out, "created     /elsewhere/.env")
+	assert.Contains(t, out, "/elsewhere/b.env: disk full")
+	assert.Contains(t, out, "1 created, 1 skipped, 1 failed")
+
+	buf.Reset()
+	PrintResults(&buf, Results{}, "/vault")
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// RetentionPolicy decides which backups of a project are kept. A zero policy keeps everything.
+type RetentionPolicy struct {
+	// KeepLast keeps the most recent backups.
+	KeepLast int
+	// KeepDaily keeps the most recent backup of each of the last days that have backups.
+	KeepDaily int
+	// KeepWeekly keeps the most recent backup of each of the last ISO weeks that have backups.
+	KeepWeekly int
+}
+
+// IsZero reports whether the policy has no rules, in which case nothing is pruned.
+func (p RetentionPolicy) IsZero() bool {
+	return p.KeepLast == 0 && p.KeepDaily == 0 && p.KeepWeekly == 0
+}
+
+func (p RetentionPolicy) Validate() error {
+	if p.KeepLast < 0 || p.KeepDaily < 0 || p.KeepWeekly < 0 {
+		return fmt.Errorf("retention values must not be negative")
+	}
+	return nil
+}
+
+// PruneDecision is the outcome of a retention policy for a single backup.
+type PruneDecision struct {
+	Backup Backup
+	Keep   bool
+	// Reasons lists the rules that keep the backup, e.g. "last", "daily" or "weekly".
+	Reasons []string
+}
+
+// ApplyRetention decides which backups to keep. Backups must be sorted by project and newest first,
+// as returned by ListBackups; every project is evaluated on its own.
+func ApplyRetention(backups []Backup, policy RetentionPolicy) []PruneDecision {
+	decisions := make([]PruneDecision, len(backups))
+
+	start := 0
+	for start < len(backups) {
+		end := start
+		for end < len(backups) && backups[end].Project == backups[start].Project {
+			end++
+		}
+
+		last, daily, weekly := 0, map[string]bool{}, map[string]bool{}
+		for i := start; i < end; i++ {
+			backup := backups[i]
+			decision := PruneDecision{Backup: backup}
+
+			if policy.IsZero() {
+				decision.Reasons = append(decision.Reasons, "no policy")
+			}
+			if last < policy.KeepLast {
+				last++
+				decision.Reasons = append(decision.Reasons, "last")
+			}
+			if day := backup.Timestamp.Format("2006-01-02"); !daily[day] && len(daily) < policy.KeepDaily {
+				daily[day] = true
+				decision.Reasons = append(decision.Reasons, "daily")
+			}
+			year, week := backup.Timestamp.ISOWeek()
+			if key := fmt.Sprintf("%d-%02d", year, week); !weekly[key] && len(weekly) < policy.KeepWeekly {
+				weekly[key] = true
+				decision.Reasons = append(decision.Reasons, "weekly")
+			}
+
+			decision.Keep = len(decision.Reasons) > 0
+			decisions[i] = decision
+		}
+		start = end
+	}
+	return decisions
+}
+
+// PlanBackupPrune applies the policy to the backups of a project, or of every project when project is empty.
+func PlanBackupPrune(vaultDir, project string, policy RetentionPolicy) ([]PruneDecision, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	backups, err := ListBackups(vaultDir)
+	if err != nil {
+		return nil, err
+	}
+	if project != "" {
+		backups = FilterBackups(backups, project)
+	}
+
+	logrus.Debugf("Applying retention policy %+v to %d backup(s)", policy, len(backups))
+	return ApplyRetention(backups, policy), nil
+}
+
+// PruneBackups deletes the backups that are not kept, removes project folders left empty and
+// then removes objects no longer used by any backup or project.
+func PruneBackups(vaultDir string, decisions []PruneDecision) error {
+	removed := 0
+	for _, decision := range decisions {
+		if decision.Keep {
+			continue
+		}
+
+		backupPath := filepath.Join(vaultDir, decision.Backup.Name)
+		if err := os.RemoveAll(backupPath); err != nil {
+			return fmt.Errorf("failed to remove backup %s: %w", decision.Backup.Name, err)
+		}
+		logrus.Debugf("Removed backup: %s", backupPath)
+		removed++
+
+		// Remove fails on purpose when the project still has other backups.
+		if err := os.Remove(filepath.Dir(backupPath)); err == nil {
+			logrus.Debugf("Removed empty backup folder: %s", filepath.Dir(backupPath))
+		}
+	}
+
+	if removed == 0 {
+		return nil
+	}
+	objects, err := CollectGarbage(vaultDir)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("Removed %d unreferenced object(s)", objects)
+	return nil
+}
+
+// PrintPrunePlan lists the backups that are removed and kept by a retention policy.
+func PrintPrunePlan(w io.Writer, decisions []PruneDecision, vaultDir string, dryRun bool) {
+	if dryRun {
+		fmt.Fprintf(w, "%s %s\n", utils.InfoIcon(), utils.WhiteText("Dry run, no backups will be removed:"))
+	}
+
+	removed := 0
+	for _, decision := range decisions {
+		path := utils.CyanText(prettifiedPath(filepath.Join(vaultDir, decision.Backup.Name), vaultDir))
+		if decision.Keep {
+			fmt.Fprintf(w, "  %-6s %s (%s)\n", "keep", path, strings.Join(decision.Reasons, ", "))
+			continue
+		}
+		removed++
+		fmt.Fprintf(w, "  %-6s %s\n", "remove", path)
+	}
+
+	verb := "removed"
+	if dryRun {
+		verb = "to remove"
+	}
+	fmt.Fprintf(w, "\n%d %s, %d kept\n", removed, verb, len(decisions)-removed)
+}
+
+// PrintPrunedBackups prints the backups removed by the retention policy after a backup. Nothing is printed
+// when every backup was kept.
+func PrintPrunedBackups(w io.Writer, decisions []PruneDecision, vaultDir string) {
+	for _, decision := range decisions {
+		if decision.Keep {
+			continue
+		}
+		path := utils.CyanText(prettifiedPath(filepath.Join(vaultDir, decision.Backup.Name), vaultDir))
+		fmt.Fprintf(w, "%s %s %s\n", utils.SuccessIcon(), utils.WhiteText("Pruned"), path)
+	}
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+func backupsAt(project string, timestamps ...string) []Backup {
+	var backups []Backup
+	for _, timestamp := range timestamps {
+		parsed, _ := utils.ParseBackupTimestamp(timestamp)
+		backups = append(backups, Backup{Project: project, Timestamp: parsed, Name: filepath.Join(BackupsDirName, project, timestamp)})
+	}
+	return backups
+}
+
+func keptTimestamps(decisions []PruneDecision) []string {
+	var kept []string
+	for _, decision := range decisions {
+		if decision.Keep {
+			kept = append(kept, decision.Backup.Timestamp.Format(utils.BackupTimestampLayout))
+		}
+	}
+	return kept
+}
+
+func TestApplyRetention(t *testing.T) {
+	// Newest first, as returned by ListBackups. 2024-05-06 is a Monday.
+	backups := backupsAt("web",
+		"2024-05-08_18-00-00",
+		"2024-05-08_09-00-00",
+		"2024-05-07_12-00-00",
+		"2024-05-06_12-00-00",
+		"2024-05-05_12-00-00",
+		"2024-05-01_12-00-00",
+		"2024-04-20_12-00-00",
+	)
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{
+		{
+			name:   "zero policy keeps everything",
+			policy: RetentionPolicy{},
+			want: []string{
+				"2024-05-08_18-00-00", "2024-05-08_09-00-00", "2024-05-07_12-00-00", "2024-05-06_12-00-00",
+				"2024-05-05_12-00-00", "2024-05-01_12-00-00", "2024-04-20_12-00-00",
+			},
+		},
+		{
+			name:   "keep last",
+			policy: RetentionPolicy{KeepLast: 2},
+			want:   []string{"2024-05-08_18-00-00", "2024-05-08_09-00-00"},
+		},
+		{
+			name:   "keep daily",
+			policy: RetentionPolicy{KeepDaily: 3},
+			want:   []string{"2024-05-08_18-00-00", "2024-05-07_12-00-00", "2024-05-06_12-00-00"},
+		},
+		{
+			name:   "keep weekly",
+			policy: RetentionPolicy{KeepWeekly: 3},
+			want:   []string{"2024-05-08_18-00-00", "2024-05-05_12-00-00", "2024-04-20_12-00-00"},
+		},
+		{
+			name:   "combined",
+			policy: RetentionPolicy{KeepLast: 1, KeepDaily: 2, KeepWeekly: 2},
+			want:   []string{"2024-05-08_18-00-00", "2024-05-07_12-00-00", "2024-05-05_12-00-00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, keptTimestamps(ApplyRetention(backups, tt.policy)))
+		})
+	}
+
+	decisions := ApplyRetention(backups, RetentionPolicy{KeepLast: 1, KeepDaily: 1})
+	assert.Equal(t, []string{"last", "daily"}, decisions[0].Reasons)
+	assert.Empty(t, decisions[1].Reasons)
+}
+
+func TestApplyRetention_PerProject(t *testing.T) {
+	backups := append(backupsAt("api", "2024-05-02_00-00-00", "2024-05-01_00-00-00"), backupsAt("web", "2024-05-03_00-00-00", "2024-05-02_00-00-00")...)
+
+	decisions := ApplyRetention(backups, RetentionPolicy{KeepLast: 1})
+	var kept []string
+	for _, decision := range decisions {
+		if decision.Keep {
+			kept = append(kept, decision.Backup.Project)
+		}
+	}
+	assert.Equal(t, []string{"api", "web"}, kept, "Expected the newest backup of every project to be kept")
+}
+
+func TestPlanAndPruneBackups(t *testing.T) {
+	vaultDir := t.TempDir()
+	writeBackup(t, vaultDir, ".backups/web/2024-05-03_00-00-00", ".env")
+	writeBackup(t, vaultDir, ".backups/web/2024-05-02_00-00-00", ".env")
+	writeBackup(t, vaultDir, ".backups/web/2024-05-01_00-00-00", ".env")
+	writeBackup(t, vaultDir, ".backups/api/2024-05-01_00-00-00", ".env")
+
+	_, err := PlanBackupPrune(vaultDir, "", RetentionPolicy{KeepLast: -1})
+	assert.Error(t, err)
+
+	decisions, err := PlanBackupPrune(vaultDir, "web", RetentionPolicy{KeepLast: 1})
+	assert.NoError(t, err)
+	assert.Len(t, decisions, 3)
+
+	var buf bytes.Buffer
+	PrintPrunePlan(&buf, decisions, vaultDir, true)
+	assert.Contains(t, buf.String(), "remove {vault}/.backups/web/2024-05-01_00-00-00")
+	assert.Contains(t, buf.String(), "keep   {vault}/.backups/web/2024-05-03_00-00-00 (last)")
+	assert.Contains(t, buf.String(), "2 to remove, 1 kept")
+	assert.DirExists(t, filepath.Join(vaultDir, ".backups", "web", "2024-05-01_00-00-00"), "Expected planning not to remove anything")
+
+	assert.NoError(t, PruneBackups(vaultDir, decisions))
+	buf.Reset()
+	PrintPrunedBackups(&buf, decisions, vaultDir)
+	assert.Contains(t, buf.String(), "Pruned {vault}/.backups/web/2024-05-01_00-00-00")
+	assert.NotContains(t, buf.String(), "2024-05-03_00-00-00", "Expected kept backups to be left out")
+	entries, err := os.ReadDir(filepath.Join(vaultDir, ".backups", "web"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "2024-05-03_00-00-00", entries[0].Name())
+	assert.DirExists(t, filepath.Join(vaultDir, ".backups", "api", "2024-05-01_00-00-00"), "Expected other projects to be untouched")
+
+	// Removing every backup of a project also removes its folder.
+	decisions, err = PlanBackupPrune(vaultDir, "api", RetentionPolicy{KeepLast: 1})
+	assert.NoError(t, err)
+	decisions[0].Keep = false
+	assert.NoError(t, PruneBackups(vaultDir, decisions))
+	assert.NoDirExists(t, filepath.Join(vaultDir, ".backups", "api"))
+}
+
+func TestRetentionPolicy_IsZero(t *testing.T) {
+	assert.True(t, RetentionPolicy{}.IsZero())
+	assert.False(t, RetentionPolicy{KeepWeekly: 1}.IsZero())
+	assert.NoError(t, RetentionPolicy{KeepDaily: 7}.Validate())
+	assert.Error(t, RetentionPolicy{KeepDaily: -1}.Validate())
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/y3owk1n/cpenv/utils"
+)
+
+// RootSource is what a project root was found by.
+type RootSource string
+
+const (
+	RootProjectConfig    RootSource = "project config"
+	RootMarker           RootSource = "marker file"
+	RootGit              RootSource = "git repository"
+	RootFlag             RootSource = "--root"
+	RootWorkingDirectory RootSource = "working directory"
+)
+
+// ProjectRoot is the directory env files are backed up from and copied into, whatever subdirectory cpenv runs in.
+type ProjectRoot struct {
+	Dir    string
+	Source RootSource
+	// Marker is the file that marked the root when Source is RootProjectConfig or RootMarker.
+	Marker string
+}
+
+// Reason describes how the root was found, e.g. "git repository" or "marker file go.work".
+func (r ProjectRoot) Reason() string {
+	if r.Marker != "" {
+		return fmt.Sprintf("%s %s", r.Source, r.Marker)
+	}
+	return string(r.Source)
+}
+
+// FindProjectRoot returns the root of the project dir is in. The first of these wins:
+//   - the directory of the closest .cpenv.yaml, see FindProjectConfig
+//   - the closest directory holding one of markers, searched up to the root of the git repository, or outside of
+//     a repository up to the home directory of the user, which is left out
+//   - the top level of the git repository
+//   - dir itself
+func FindProjectRoot(dir string, markers []string) (ProjectRoot, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ProjectRoot{}, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	config, ok, err := FindProjectConfig(dir)
+	if err != nil {
+		return ProjectRoot{}, err
+	}
+	if ok {
+		return ProjectRoot{Dir: config.Dir(), Source: RootProjectConfig, Marker: ProjectConfigFileName}, nil
+	}
+
+	repoRoot, inRepo := findRepositoryRoot(dir)
+	if len(markers) > 0 {
+		// A stray package.json or go.mod in the home directory does not make it the root of every project below.
+		home := ""
+		if !inRepo {
+			if home, err = UserHomeDirFunc(); err != nil {
+				logrus.Debugf("Failed to find the home directory: %v", err)
+			}
+		}
+		for current := dir; ; current = filepath.Dir(current) {
+			for _, marker := range markers {
+				_, err := os.Stat(filepath.Join(current, marker))
+				if err == nil {
+					logrus.Debugf("Found root marker %s in %s", marker, current)
+					return ProjectRoot{Dir: current, Source: RootMarker, Marker: marker}, nil
+				}
+				if !errors.Is(err, fs.ErrNotExist) {
+					return ProjectRoot{}, fmt.Errorf("failed to check %s: %w", filepath.Join(current, marker), err)
+				}
+			}
+			if (inRepo && current == repoRoot) || (home != "" && filepath.Dir(current) == home) || filepath.Dir(current) == current {
+				break
+			}
+		}
+	}
+
+	if inRepo {
+		return ProjectRoot{Dir: repoRoot, Source: RootGit}, nil
+	}
+	return ProjectRoot{Dir: dir, Source: RootWorkingDirectory}, nil
+}
+
+// PrintProjectRoot shows the root and how it was found.
+func PrintProjectRoot(w io.Writer, root ProjectRoot) {
+	fmt.Fprintf(w, "%s %s %s (%s)\n", utils.InfoIcon(), utils.WhiteText("Project root:"), utils.CyanText(root.Dir), root.Reason())
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindProjectRoot(t *testing.T) {
+	repo := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, ".git"), 0755))
+	web := filepath.Join(repo, "services", "shop", "apps", "web")
+	assert.NoError(t, os.MkdirAll(web, 0755))
+
+	root, err := FindProjectRoot(web, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ProjectRoot{Dir: repo, Source: RootGit}, root)
+	assert.Equal(t, "git repository", root.Reason())
+
+	shop := filepath.Join(repo, "services", "shop")
+	assert.NoError(t, os.WriteFile(filepath.Join(shop, "cpenv-root.marker"), nil, 0644))
+	root, err = FindProjectRoot(web, []string{"missing.marker", "cpenv-root.marker"})
+	assert.NoError(t, err)
+	assert.Equal(t, ProjectRoot{Dir: shop, Source: RootMarker, Marker: "cpenv-root.marker"}, root, "Expected the closest marker to win over git")
+	assert.Equal(t, "marker file cpenv-root.marker", root.Reason())
+
+	writeProjectConfig(t, repo, "project: web\n")
+	root, err = FindProjectRoot(web, []string{"cpenv-root.marker"})
+	assert.NoError(t, err)
+	assert.Equal(t, ProjectRoot{Dir: repo, Source: RootProjectConfig, Marker: ProjectConfigFileName}, root, "Expected .cpenv.yaml to win over markers")
+}
+
+func TestFindProjectRoot_OutsideRepository(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "apps", "web")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+
+	root, err := FindProjectRoot(dir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ProjectRoot{Dir: dir, Source: RootWorkingDirectory}, root)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(base, "cpenv-root.marker"), nil, 0644))
+	root, err = FindProjectRoot(dir, []string{"cpenv-root.marker"})
+	assert.NoError(t, err)
+	assert.Equal(t, ProjectRoot{Dir: base, Source: RootMarker, Marker: "cpenv-root.marker"}, root, "Expected markers to be searched outside of a repository")
+}
+
+func TestFindProjectRoot_StopsAtHome(t *testing.T) {
+	home := useTempHome(t)
+	dir := filepath.Join(home, "code", "web")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(home, "cpenv-root.marker"), nil, 0644))
+
+	root, err := FindProjectRoot(dir, []string{"cpenv-root.marker"})
+	assert.NoError(t, err)
+	assert.Equal(t, ProjectRoot{Dir: dir, Source: RootWorkingDirectory}, root, "Expected a marker in the home directory to be ignored")
+
+	root, err = FindProjectRoot(home, []string{"cpenv-root.marker"})
+	assert.NoError(t, err)
+	assert.Equal(t, ProjectRoot{Dir: home, Source: RootMarker, Marker: "cpenv-root.marker"}, root, "Expected the working directory to be searched")
+}
+
+func TestFindProjectRoot_InvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeProjectConfig(t, dir, "project: ../web\n")
+
+	_, err := FindProjectRoot(dir, nil)
+	assert.Error(t, err)
+}
+
+func TestPrintProjectRoot(t *testing.T) {
+	var buf bytes.Buffer
+	PrintProjectRoot(&buf, ProjectRoot{Dir: "/src/app", Source: RootFlag})
+	assert.Contains(t, buf.String(), "/src/app")
+	assert.Contains(t, buf.String(), "(--root)")
+}
@@ -0,0 +1,643 @@
+// Package dotenv parses and re-emits dotenv files without losing comments, blank lines,
+// quoting or line endings, so that key-aware features can rewrite files in place.
+package dotenv
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// byteOrderMark is written at the start of files by some Windows editors.
+const byteOrderMark = "\ufeff"
+
+// LineKind tells what a single line of a dotenv file holds.
+type LineKind int
+
+const (
+	LineBlank LineKind = iota
+	LineComment
+	LineEntry
+)
+
+// Line is one logical line of a dotenv file. An entry with a quoted multiline value spans several
+// physical lines. Raw keeps the original text, including the line ending, so that a parsed file
+// renders back byte for byte.
+type Line struct {
+	Kind   LineKind
+	Raw    string
+	Key    string
+	Value  string
+	Export bool
+	// Quote is the quote character around the value: 0, '\'', '"' or '`'.
+	Quote byte
+	// Refs are the ${VAR} and $VAR references found in the value, in order.
+	Refs []Ref
+	// Number is the 1-based line number where the line starts in the parsed file.
+	Number int
+}
+
+// Ref is a variable reference inside a value. Start and End are byte offsets into Line.Value.
+type Ref struct {
+	Name       string
+	Default    string
+	HasDefault bool
+	Start      int
+	End        int
+}
+
+// File is a parsed dotenv file with its lines kept in order.
+type File struct {
+	Lines []Line
+	// bom is set when the file starts with a byte order mark, which is written back by String.
+	bom bool
+}
+
+// ParseError reports where a dotenv file could not be parsed. Line and Column are 1-based.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+func Parse(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dotenv: %w", err)
+	}
+	return ParseString(string(data))
+}
+
+// ParseString parses a dotenv file. A leading UTF-8 byte order mark is skipped and kept for String.
+func ParseString(src string) (*File, error) {
+	file := &File{bom: strings.HasPrefix(src, byteOrderMark)}
+	src = strings.TrimPrefix(src, byteOrderMark)
+	p := &parser{src: src, line: 1}
+	for p.pos < len(p.src) {
+		line, err := p.parseLine()
+		if err != nil {
+			return nil, err
+		}
+		file.Lines = append(file.Lines, line)
+	}
+	return file, nil
+}
+
+func ParseFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	file, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return file, nil
+}
+
+type parser struct {
+	src string
+	pos int
+	// line and lineStart track the physical line of pos for error positions.
+	line      int
+	lineStart int
+	// valueStart and valueEnd delimit the value of the last parsed entry as spelled in src, quotes included.
+	valueStart int
+	valueEnd   int
+}
+
+func (p *parser) errorf(pos int, format string, args ...any) error {
+	line, lineStart := p.line, p.lineStart
+	for i := p.lineStart; i < pos && i < len(p.src); i++ {
+		if p.src[i] == '\n' {
+			line++
+			lineStart = i + 1
+		}
+	}
+	return &ParseError{Line: line, Column: pos - lineStart + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) atLineEnd() bool {
+	return p.pos >= len(p.src) || p.src[p.pos] == '\n' || strings.HasPrefix(p.src[p.pos:], "\r\n")
+}
+
+// finishLine consumes the rest of the current physical line including its terminator.
+func (p *parser) finishLine() {
+	if i := strings.IndexByte(p.src[p.pos:], '\n'); i >= 0 {
+		p.pos += i + 1
+	} else {
+		p.pos = len(p.src)
+	}
+	p.advanceLines()
+}
+
+// advanceLines brings the line counters up to date with pos.
+func (p *parser) advanceLines() {
+	for i := p.lineStart; i < p.pos; i++ {
+		if p.src[i] == '\n' {
+			p.line++
+			p.lineStart = i + 1
+		}
+	}
+}
+
+func (p *parser) parseLine() (Line, error) {
+	start := p.pos
+	line := Line{Number: p.line}
+
+	p.skipSpaces()
+	switch {
+	case p.atLineEnd():
+		line.Kind = LineBlank
+		p.finishLine()
+		line.Raw = p.src[start:p.pos]
+		return line, nil
+	case p.peek() == '#':
+		line.Kind = LineComment
+		p.finishLine()
+		line.Raw = p.src[start:p.pos]
+		return line, nil
+	}
+
+	if rest := p.src[p.pos:]; strings.HasPrefix(rest, "export") && len(rest) > 6 && (rest[6] == ' ' || rest[6] == '\t') {
+		line.Export = true
+		p.pos += 6
+		p.skipSpaces()
+	}
+
+	keyStart := p.pos
+	for p.pos < len(p.src) && isKeyChar(p.src[p.pos], p.pos == keyStart) {
+		p.pos++
+	}
+	if p.pos == keyStart {
+		return Line{}, p.errorf(p.pos, "expected a key")
+	}
+	line.Key = p.src[keyStart:p.pos]
+
+	p.skipSpaces()
+	if p.peek() != '=' {
+		return Line{}, p.errorf(p.pos, "expected '=' after key %q", line.Key)
+	}
+	p.pos++
+	p.skipSpaces()
+
+	var err error
+	p.valueStart = p.pos
+	switch quote := p.peek(); quote {
+	case '\'', '"', '`':
+		line.Quote = quote
+		line.Value, line.Refs, err = p.parseQuoted(quote)
+		if err != nil {
+			return Line{}, err
+		}
+		p.valueEnd = p.pos
+		p.skipSpaces()
+		if !p.atLineEnd() && p.peek() != '#' {
+			return Line{}, p.errorf(p.pos, "unexpected character %q after quoted value", p.peek())
+		}
+	default:
+		line.Value = p.parseUnquoted()
+		line.Refs = findRefs(line.Value)
+		p.valueEnd = p.valueStart + len(line.Value)
+	}
+
+	p.finishLine()
+	line.Kind = LineEntry
+	line.Raw = p.src[start:p.pos]
+	return line, nil
+}
+
+func isKeyChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		return true
+	case c == '.', c == '-', c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
+
+// parseUnquoted reads a bare value up to the end of the line or an inline comment.
+func (p *parser) parseUnquoted() string {
+	start := p.pos
+	end := p.pos
+	for p.pos < len(p.src) && !p.atLineEnd() {
+		c := p.src[p.pos]
+		if c == '#' && p.pos > 0 && (p.src[p.pos-1] == ' ' || p.src[p.pos-1] == '\t') {
+			break
+		}
+		p.pos++
+		if c != ' ' && c != '\t' {
+			end = p.pos
+		}
+	}
+	return p.src[start:end]
+}
+
+// parseQuoted reads a quoted value that may span several lines. Only double quoted values
+// process escape sequences, and single quoted and backtick values are never interpolated.
+func (p *parser) parseQuoted(quote byte) (string, []Ref, error) {
+	open := p.pos
+	p.pos++
+
+	var b strings.Builder
+	var refs []Ref
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), refs, nil
+		case c == '\\' && quote == '"' && p.pos+1 < len(p.src):
+			if decoded, ok := unescapeChar(p.src[p.pos+1]); ok {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteByte(c)
+				b.WriteByte(p.src[p.pos+1])
+			}
+			p.pos += 2
+		case c == '$' && quote == '"':
+			if ref, n, ok := parseRef(p.src[p.pos:]); ok {
+				ref.Start = b.Len()
+				b.WriteString(p.src[p.pos : p.pos+n])
+				ref.End = b.Len()
+				refs = append(refs, ref)
+				p.pos += n
+				continue
+			}
+			b.WriteByte(c)
+			p.pos++
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", nil, p.errorf(open, "unterminated %c quote", quote)
+}
+
+func unescapeChar(c byte) (byte, bool) {
+	switch c {
+	case 'n':
+		return '\n', true
+	case 'r':
+		return '\r', true
+	case 't':
+		return '\t', true
+	case '"', '\\', '$', '`', '\'':
+		return c, true
+	}
+	return 0, false
+}
+
+func findRefs(value string) []Ref {
+	var refs []Ref
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' {
+			continue
+		}
+		if ref, n, ok := parseRef(value[i:]); ok {
+			ref.Start, ref.End = i, i+n
+			refs = append(refs, ref)
+			i += n - 1
+		}
+	}
+	return refs
+}
+
+// parseRef parses ${NAME}, ${NAME:-default} or $NAME at the start of s and returns its length.
+func parseRef(s string) (Ref, int, bool) {
+	if len(s) < 2 || s[0] != '$' {
+		return Ref{}, 0, false
+	}
+
+	if s[1] != '{' {
+		n := 1
+		for n < len(s) && isKeyChar(s[n], n == 1) && s[n] != '.' && s[n] != '-' {
+			n++
+		}
+		if n == 1 {
+			return Ref{}, 0, false
+		}
+		return Ref{Name: s[1:n]}, n, true
+	}
+
+	end := strings.IndexByte(s, '}')
+	if end < 0 {
+		return Ref{}, 0, false
+	}
+	ref := Ref{Name: s[2:end]}
+	if name, def, ok := strings.Cut(ref.Name, ":-"); ok {
+		ref.Name, ref.Default, ref.HasDefault = name, def, true
+	}
+	if ref.Name == "" {
+		return Ref{}, 0, false
+	}
+	for i := 0; i < len(ref.Name); i++ {
+		if !isKeyChar(ref.Name[i], i == 0) {
+			return Ref{}, 0, false
+		}
+	}
+	return ref, end + 1, true
+}
+
+// Get returns the value of the last assignment of key.
+func (f *File) Get(key string) (string, bool) {
+	for i := len(f.Lines) - 1; i >= 0; i-- {
+		if f.Lines[i].Kind == LineEntry && f.Lines[i].Key == key {
+			return f.Lines[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Keys returns every key once, in the order it first appears.
+func (f *File) Keys() []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, line := range f.Lines {
+		if line.Kind == LineEntry && !seen[line.Key] {
+			seen[line.Key] = true
+			keys = append(keys, line.Key)
+		}
+	}
+	return keys
+}
+
+// Map returns the key/value pairs of the file without expanding references; later assignments win.
+func (f *File) Map() map[string]string {
+	values := map[string]string{}
+	for _, line := range f.Lines {
+		if line.Kind == LineEntry {
+			values[line.Key] = line.Value
+		}
+	}
+	return values
+}
+
+// Expand returns the key/value pairs of the file with references resolved. A reference resolves to
+// a key assigned earlier in the file, then to lookup (which may be nil), then to its default.
+func (f *File) Expand(lookup func(string) (string, bool)) map[string]string {
+	values := map[string]string{}
+	for _, line := range f.Lines {
+		if line.Kind != LineEntry {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, ref := range line.Refs {
+			b.WriteString(line.Value[last:ref.Start])
+			last = ref.End
+
+			if value, ok := values[ref.Name]; ok && (value != "" || !ref.HasDefault) {
+				b.WriteString(value)
+				continue
+			}
+			if lookup != nil {
+				if value, ok := lookup(ref.Name); ok && (value != "" || !ref.HasDefault) {
+					b.WriteString(value)
+					continue
+				}
+			}
+			b.WriteString(ref.Default)
+		}
+		b.WriteString(line.Value[last:])
+		values[line.Key] = b.String()
+	}
+	return values
+}
+
+// String renders the file back to text. A file that was parsed and not modified renders unchanged.
+func (f *File) String() string {
+	var b strings.Builder
+	if f.bom {
+		b.WriteString(byteOrderMark)
+	}
+	for _, line := range f.Lines {
+		b.WriteString(line.Raw)
+	}
+	return b.String()
+}
+
+// Set assigns value to every assignment of key, or appends a new entry when the key is missing.
+// The file is left unchanged when key is not a valid key.
+func (f *File) Set(key, value string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	found := false
+	for i := range f.Lines {
+		if f.Lines[i].Kind == LineEntry && f.Lines[i].Key == key {
+			line, err := NewEntry(key, value, f.Lines[i].Export, lineEnding(f.Lines[i].Raw))
+			if err != nil {
+				return err
+			}
+			f.Lines[i] = line
+			found = true
+		}
+	}
+	if !found {
+		line, err := NewEntry(key, value, false, "\n")
+		if err != nil {
+			return err
+		}
+		f.appendLines(line)
+	}
+	return nil
+}
+
+// ValidateKey returns an error unless key is a letter or underscore followed by letters, digits,
+// underscores, dots or dashes.
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("invalid key: empty")
+	}
+	for i := 0; i < len(key); i++ {
+		if !isKeyChar(key[i], i == 0) {
+			return fmt.Errorf("invalid key %q: unexpected character %q at position %d", key, key[i], i+1)
+		}
+	}
+	return nil
+}
+
+// NewEntry builds an entry line, quoting value only when needed so that it parses back unchanged.
+func NewEntry(key, value string, export bool, ending string) (Line, error) {
+	if err := ValidateKey(key); err != nil {
+		return Line{}, err
+	}
+	raw := key + "=" + FormatValue(value) + ending
+	if export {
+		raw = "export " + raw
+	}
+
+	// Re-parse so that quoting, references and positions match what a reader of the file will see.
+	line, err := (&parser{src: raw, line: 1}).parseLine()
+	if err != nil {
+		return Line{}, fmt.Errorf("formatted entry for %s does not parse: %w", key, err)
+	}
+	return line, nil
+}
+
+// FormatValue quotes a value for writing. Plain values are written bare, values without single
+// quotes or newlines are single quoted, and everything else is double quoted with escapes.
+func FormatValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	if !strings.ContainsAny(value, " \t\r\n#'\"`$\\=") {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\r\n") {
+		return "'" + value + "'"
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+func lineEnding(raw string) string {
+	switch {
+	case strings.HasSuffix(raw, "\r\n"):
+		return "\r\n"
+	case strings.HasSuffix(raw, "\n"):
+		return "\n"
+	}
+	return ""
+}
+
+// mainLineEnding returns the line ending used by most lines of the file, "\n" when there is none.
+func (f *File) mainLineEnding() string {
+	crlf, lf := 0, 0
+	for _, line := range f.Lines {
+		switch lineEnding(line.Raw) {
+		case "\r\n":
+			crlf++
+		case "\n":
+			lf++
+		}
+	}
+	if crlf > lf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// appendLines adds lines at the end of the file, terminating the current last line first if needed.
+// Added lines end with the main line ending of the file.
+func (f *File) appendLines(lines ...Line) {
+	ending := f.mainLineEnding()
+	if n := len(f.Lines); n > 0 {
+		last := &f.Lines[n-1]
+		if lineEnding(last.Raw) == "" {
+			last.Raw += ending
+		}
+	}
+
+	for _, line := range lines {
+		line.Raw = strings.TrimSuffix(line.Raw, lineEnding(line.Raw)) + ending
+		f.Lines = append(f.Lines, line)
+	}
+	f.renumber()
+}
+
+func (f *File) renumber() {
+	number := 1
+	for i := range f.Lines {
+		f.Lines[i].Number = number
+		number += strings.Count(strings.TrimSuffix(f.Lines[i].Raw, "\n"), "\n") + 1
+	}
+}
+
+// Merge combines src into dst while keeping the comments, blank lines and ordering of dst.
+// Keys only in dst are kept, keys only in src are appended at the end, and shared keys take
+// the value from src when preferSrc is set or keep the value from dst otherwise.
+func Merge(dst, src *File, preferSrc bool) (*File, error) {
+	srcLines := map[string]Line{}
+	for _, line := range src.Lines {
+		if line.Kind == LineEntry {
+			srcLines[line.Key] = line
+		}
+	}
+
+	merged := &File{bom: dst.bom}
+	seen := map[string]bool{}
+	for _, line := range dst.Lines {
+		if line.Kind == LineEntry {
+			seen[line.Key] = true
+			if srcLine, ok := srcLines[line.Key]; ok && preferSrc && srcLine.Value != line.Value {
+				replaced, err := replaceValue(line, srcLine)
+				if err != nil {
+					return nil, err
+				}
+				line = replaced
+			}
+		}
+		merged.Lines = append(merged.Lines, line)
+	}
+
+	var added []Line
+	for _, key := range src.Keys() {
+		if !seen[key] {
+			added = append(added, srcLines[key])
+		}
+	}
+	if len(added) > 0 {
+		if n := len(merged.Lines); n > 0 && merged.Lines[n-1].Kind != LineBlank {
+			added = append([]Line{{Kind: LineBlank}}, added...)
+		}
+		merged.appendLines(added...)
+	}
+
+	merged.renumber()
+	return merged, nil
+}
+
+// replaceValue returns dst with the value of src, spelled as in the file of src. The key, export prefix,
+// spacing, inline comment and line ending of dst are kept.
+func replaceValue(dst, src Line) (Line, error) {
+	dstStart, dstEnd, err := valueSpan(dst)
+	if err != nil {
+		return Line{}, err
+	}
+	srcStart, srcEnd, err := valueSpan(src)
+	if err != nil {
+		return Line{}, err
+	}
+
+	raw := dst.Raw[:dstStart] + src.Raw[srcStart:srcEnd] + dst.Raw[dstEnd:]
+	line, err := (&parser{src: raw, line: 1}).parseLine()
+	if err != nil || line.Key != dst.Key || line.Value != src.Value {
+		return Line{}, fmt.Errorf("cannot replace the value of %s on line %d", dst.Key, dst.Number)
+	}
+	return line, nil
+}
+
+// valueSpan returns where the value of an entry starts and ends in its raw text.
+func valueSpan(line Line) (int, int, error) {
+	p := &parser{src: line.Raw, line: 1}
+	if parsed, err := p.parseLine(); err != nil || parsed.Kind != LineEntry {
+		return 0, 0, fmt.Errorf("line %d is not an entry", line.Number)
+	}
+	return p.valueStart, p.valueEnd, nil
+}
@@ -0,0 +1,309 @@
+package dotenv
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// roundTripCases are inputs that must render back byte for byte after parsing.
+var roundTripCases = map[string]string{
+	"empty":                "",
+	"blank lines":          "\n\n  \n",
+	"comments":             "# top\n  # indented\nKEY=1 # inline\n",
+	"no final newline":     "A=1\nB=2",
+	"crlf":                 "A=1\r\n# c\r\n\r\nB=\"x\"\r\n",
+	"export":               "export A=1\nexport\tB='2'\n",
+	"spaces around equals": "KEY = value\n  OTHER\t=\t'x'  \n",
+	"single quotes":        "A='raw \\n $HOME'\n",
+	"double quotes":        "A=\"esc \\\" \\\\ \\n \\$ ${HOME}\"\n",
+	"backticks":            "A=`it's \"both\"`\n",
+	"multiline":            "CERT=\"-----BEGIN-----\nabc\n-----END-----\"\nNEXT=1\n",
+	"multiline single":     "A='one\ntwo'\n",
+	"references":           "A=${B:-x}/$C\n",
+	"empty values":         "A=\nB=''\nC=\"\"\n",
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, input := range roundTripCases {
+		t.Run(name, func(t *testing.T) {
+			file, err := ParseString(input)
+			assert.NoError(t, err)
+			assert.Equal(t, input, file.String())
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	input := `# database
+DB_HOST=localhost
+export DB_PORT=5432
+
+SINGLE='raw \n'
+DOUBLE="line\nbreak \"quoted\""
+INLINE=value # comment
+HASH=abc#def
+EMPTY=
+COMMENT_ONLY= # nothing here
+`
+	file, err := Parse(strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Len(t, file.Lines, 10)
+	assert.Equal(t, LineComment, file.Lines[0].Kind)
+	assert.Equal(t, LineBlank, file.Lines[3].Kind)
+
+	assert.Equal(t, []string{"DB_HOST", "DB_PORT", "SINGLE", "DOUBLE", "INLINE", "HASH", "EMPTY", "COMMENT_ONLY"}, file.Keys())
+	assert.True(t, file.Lines[2].Export)
+	assert.Equal(t, 3, file.Lines[2].Number)
+	assert.Equal(t, byte('\''), file.Lines[4].Quote)
+
+	values := file.Map()
+	assert.Equal(t, "localhost", values["DB_HOST"])
+	assert.Equal(t, "5432", values["DB_PORT"])
+	assert.Equal(t, `raw \n`, values["SINGLE"])
+	assert.Equal(t, "line\nbreak \"quoted\"", values["DOUBLE"])
+	assert.Equal(t, "value", values["INLINE"])
+	assert.Equal(t, "abc#def", values["HASH"])
+	assert.Equal(t, "", values["EMPTY"])
+	assert.Equal(t, "", values["COMMENT_ONLY"])
+}
+
+func TestParse_QuotingStyles(t *testing.T) {
+	file, err := ParseString("SINGLE='a\\nb # not a comment'\nBACKTICK=`say \"hi\" it's`\nESCAPES=\"tab\\there \\$HOME \\q\"\n")
+	assert.NoError(t, err)
+	values := file.Map()
+	assert.Equal(t, `a\nb # not a comment`, values["SINGLE"])
+	assert.Equal(t, `say "hi" it's`, values["BACKTICK"])
+	assert.Equal(t, "tab\there $HOME \\q", values["ESCAPES"], "Expected unknown escapes to be kept as written")
+}
+
+func TestParse_Multiline(t *testing.T) {
+	input := "A=1\nKEY=\"first\nsecond\"\nB=`x\ny`\nC=3\n"
+	file, err := ParseString(input)
+	assert.NoError(t, err)
+	assert.Len(t, file.Lines, 4)
+	assert.Equal(t, "first\nsecond", file.Map()["KEY"])
+	assert.Equal(t, "x\ny", file.Map()["B"])
+	assert.Equal(t, 2, file.Lines[1].Number)
+	assert.Equal(t, 4, file.Lines[2].Number)
+	assert.Equal(t, 6, file.Lines[3].Number)
+}
+
+func TestParse_LaterAssignmentWins(t *testing.T) {
+	file, err := Parse(strings.NewReader("KEY=first\nKEY=second\n"))
+	assert.NoError(t, err)
+	value, ok := file.Get("KEY")
+	assert.True(t, ok)
+	assert.Equal(t, "second", value)
+	assert.Equal(t, []string{"KEY"}, file.Keys())
+
+	_, ok = file.Get("MISSING")
+	assert.False(t, ok)
+}
+
+func TestParse_References(t *testing.T) {
+	file, err := ParseString("A=${HOST}:$PORT\nB=\"${USER:-nobody} \\${LITERAL}\"\nC='${NOT_A_REF}'\nD=$ alone\n")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Ref{
+		{Name: "HOST", Start: 0, End: 7},
+		{Name: "PORT", Start: 8, End: 13},
+	}, file.Lines[0].Refs)
+	assert.Equal(t, []Ref{{Name: "USER", Default: "nobody", HasDefault: true, Start: 0, End: 15}}, file.Lines[1].Refs)
+	assert.Equal(t, "${USER:-nobody} ${LITERAL}", file.Lines[1].Value)
+	assert.Empty(t, file.Lines[2].Refs)
+	assert.Empty(t, file.Lines[3].Refs)
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+		msg    string
+	}{
+		{input: "OK=1\nNOT_AN_ASSIGNMENT\n", line: 2, column: 18, msg: "expected '='"},
+		{input: "1KEY=value", line: 1, column: 1, msg: "expected a key"},
+		{input: "A=1\n  KEY=\"unterminated\nstill open", line: 2, column: 7, msg: "unterminated \" quote"},
+		{input: "KEY='value' trailing", line: 1, column: 13, msg: "unexpected character"},
+		{input: "A=\"multi\nline\" x\n", line: 2, column: 7, msg: "unexpected character"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseString(tt.input)
+		assert.Error(t, err, tt.input)
+		var parseErr *ParseError
+		if assert.ErrorAs(t, err, &parseErr, tt.input) {
+			assert.Equal(t, tt.line, parseErr.Line, tt.input)
+			assert.Equal(t, tt.column, parseErr.Column, tt.input)
+			assert.Contains(t, parseErr.Msg, tt.msg, tt.input)
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	assert.NoError(t, os.WriteFile(path, []byte("KEY=value\n"), 0644))
+
+	file, err := ParseFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"KEY": "value"}, file.Map())
+
+	_, err = ParseFile(filepath.Join(t.TempDir(), "missing.env"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open")
+
+	broken := filepath.Join(t.TempDir(), ".env")
+	assert.NoError(t, os.WriteFile(broken, []byte("A=1\nB\n"), 0644))
+	_, err = ParseFile(broken)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2, column 2")
+}
+
+func TestExpand(t *testing.T) {
+	file, err := ParseString("HOST=localhost\nURL=http://${HOST}:${PORT:-8080}/$NAME\nRAW='${HOST}'\nESCAPED=\"\\${HOST}\"\nHOME_DIR=$HOME\n")
+	assert.NoError(t, err)
+
+	env := map[string]string{"NAME": "app", "HOME": "/home/me"}
+	values := file.Expand(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+	assert.Equal(t, "http://localhost:8080/app", values["URL"])
+	assert.Equal(t, "${HOST}", values["RAW"])
+	assert.Equal(t, "${HOST}", values["ESCAPED"])
+	assert.Equal(t, "/home/me", values["HOME_DIR"])
+
+	values = file.Expand(nil)
+	assert.Equal(t, "http://localhost:8080/", values["URL"])
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := map[string]string{
+		"":                 "",
+		"plain":            "plain",
+		"with space":       "'with space'",
+		"$HOME":            "'$HOME'",
+		"it's":             `"it's"`,
+		"line\nbreak":      `"line\nbreak"`,
+		`back\slash "q"`:   `'back\slash "q"'`,
+		"it's $HOME \\ \"": `"it's \$HOME \\ \""`,
+	}
+	for value, want := range tests {
+		assert.Equal(t, want, FormatValue(value), value)
+
+		// Every formatted value must parse back to itself.
+		file, err := ParseString("KEY=" + FormatValue(value) + "\n")
+		assert.NoError(t, err, value)
+		assert.Equal(t, value, file.Map()["KEY"], value)
+		assert.Equal(t, value, file.Expand(nil)["KEY"], value)
+	}
+}
+
+func TestSet(t *testing.T) {
+	file, err := ParseString("# comment\nexport A=1\r\nB=2")
+	assert.NoError(t, err)
+
+	assert.NoError(t, file.Set("A", "new value"))
+	assert.NoError(t, file.Set("C", "3"))
+	assert.Equal(t, "# comment\nexport A='new value'\r\nB=2\nC=3\n", file.String())
+	assert.Equal(t, 4, file.Lines[3].Number)
+}
+
+func TestSet_InvalidKey(t *testing.T) {
+	file, err := ParseString("A=1\n")
+	assert.NoError(t, err)
+
+	for _, key := range []string{"", "bad key", "1A", "A=B", "export A"} {
+		assert.Error(t, file.Set(key, "v"), key)
+		_, err := NewEntry(key, "v", false, "\n")
+		assert.Error(t, err, key)
+	}
+	assert.Equal(t, "A=1\n", file.String(), "Expected invalid keys to leave the file unchanged")
+
+	assert.NoError(t, ValidateKey("_A.b-1"))
+}
+
+func TestParse_ByteOrderMark(t *testing.T) {
+	file, err := ParseString("\ufeffA=1\nB=2\n")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"A": "1", "B": "2"}, file.Map())
+	assert.Equal(t, "\ufeffA=1\nB=2\n", file.String(), "Expected the byte order mark to be written back")
+}
+
+func TestMerge(t *testing.T) {
+	local, err := ParseString("# local settings\nPORT=4000\nexport API_KEY=old # rotate me\n\n# mine\nDEBUG=true\n")
+	assert.NoError(t, err)
+	vault, err := ParseString("API_KEY='new'\nPORT=3000\nNEW_SECRET=abc\n")
+	assert.NoError(t, err)
+
+	merged, err := Merge(local, vault, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "# local settings\nPORT=3000\nexport API_KEY='new' # rotate me\n\n# mine\nDEBUG=true\n\nNEW_SECRET=abc\n", merged.String())
+
+	merged, err = Merge(local, vault, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "# local settings\nPORT=4000\nexport API_KEY=old # rotate me\n\n# mine\nDEBUG=true\n\nNEW_SECRET=abc\n", merged.String())
+	assert.Equal(t, map[string]string{"PORT": "4000", "API_KEY": "old", "DEBUG": "true", "NEW_SECRET": "abc"}, merged.Map())
+}
+
+func TestMerge_KeepsDestinationSpelling(t *testing.T) {
+	local, err := ParseString("PORT=3000 # mine\r\nexport  HOST = \"a\"\t# host\r\nTOKEN=x\r\n")
+	assert.NoError(t, err)
+	vault, err := ParseString("PORT=4000 # vault comment\nHOST='b c'\nCERT=\"x\ny\"\nNEW=1 # added\n")
+	assert.NoError(t, err)
+
+	merged, err := Merge(local, vault, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "PORT=4000 # mine\r\nexport  HOST = 'b c'\t# host\r\nTOKEN=x\r\n\r\nCERT=\"x\ny\"\r\nNEW=1 # added\r\n", merged.String(),
+		"Expected only values to change and appended lines to use the CRLF endings of the file")
+
+	reparsed, err := ParseString(merged.String())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"PORT": "4000", "HOST": "b c", "TOKEN": "x", "CERT": "x\ny", "NEW": "1"}, reparsed.Map())
+}
+
+func TestMerge_NothingToAdd(t *testing.T) {
+	local, err := ParseString("A=1\nB=2\n")
+	assert.NoError(t, err)
+	vault, err := ParseString("B=2\n")
+	assert.NoError(t, err)
+
+	merged, err := Merge(local, vault, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "A=1\nB=2\n", merged.String())
+}
+
+func TestMerge_NoFinalNewlineAndMultiline(t *testing.T) {
+	local, err := ParseString("A=1")
+	assert.NoError(t, err)
+	vault, err := ParseString("CERT=\"x\ny\"")
+	assert.NoError(t, err)
+
+	merged, err := Merge(local, vault, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "A=1\n\nCERT=\"x\ny\"\n", merged.String())
+
+	reparsed, err := ParseString(merged.String())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"A": "1", "CERT": "x\ny"}, reparsed.Map())
+	assert.Equal(t, 3, merged.Lines[2].Number)
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, input := range roundTripCases {
+		f.Add(input)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		file, err := ParseString(input)
+		if err != nil {
+			return
+		}
+		if got := file.String(); got != input {
+			t.Fatalf("round trip mismatch:\n got: %q\nwant: %q", got, input)
+		}
+	})
+}
@@ -3,6 +3,8 @@ module github.com/y3owk1n/cpenv
 go 1.23.9
 
 require (
+	filippo.io/age v1.2.1
+	github.com/bmatcuk/doublestar/v4 v4.9.1
 	github.com/briandowns/spinner v1.23.2
 	github.com/fatih/color v1.14.1
 	github.com/manifoldco/promptui v0.9.0
@@ -33,9 +35,10 @@ require (
 	github.com/subosito/gotenv v1.6.0 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.9.0 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d // indirect
 	golang.org/x/sys v0.27.0 // indirect
-	golang.org/x/term v0.1.0 // indirect
+	golang.org/x/term v0.21.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
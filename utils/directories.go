@@ -1,11 +1,14 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
@@ -79,13 +82,13 @@ func GetCurrentWorkingDirectory() string {
 func ReadDirRecursive(dirPath string) ([]string, error) {
 	logrus.Debugf("Reading directory recursively: %s", dirPath)
 	var files []string
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			logrus.Errorf("Error accessing path %s: %v", path, err)
 			return fmt.Errorf("error accessing path %s: %w", path, err)
 		}
 
-		if !info.IsDir() {
+		if !d.IsDir() {
 			files = append(files, path)
 		}
 		return nil
@@ -101,19 +104,116 @@ func ReadDirRecursive(dirPath string) ([]string, error) {
 // Id defaults to ReadDirRecursive but can be overridden in tests.
 var ReadDirRecursiveFunc = ReadDirRecursive
 
-func OpenInFinder(dirPath string) error {
-	logrus.Debugf("Attempting to open directory in Finder: %s", dirPath)
-	if runtime.GOOS != "darwin" {
-		logrus.Errorf("OpenInFinder is only supported on macOS. Current OS: %s", runtime.GOOS)
-		return fmt.Errorf("this function is only supported on macOS")
+// PruneOptions controls which directories ReadDirPruned does not descend into.
+type PruneOptions struct {
+	// Prune lists directory names or doublestar globs matched against the path relative to the walk root.
+	Prune []string
+	// Gitignore honors .gitignore files found during the walk and .git/info/exclude at the walk root.
+	Gitignore bool
+}
+
+// ReadDirPruned lists every file under dirPath like ReadDirRecursive, but skips pruned directories
+// without reading them. Only directories are pruned; ignored files are still listed.
+func ReadDirPruned(dirPath string, opts PruneOptions) ([]string, error) {
+	logrus.Debugf("Reading directory with pruning: %s, prune: %v, gitignore: %t", dirPath, opts.Prune, opts.Gitignore)
+
+	matcher := &IgnoreMatcher{}
+	if opts.Gitignore {
+		if err := matcher.AddFile(filepath.Join(dirPath, ".git", "info", "exclude"), ""); err != nil {
+			logrus.Warnf("Failed to load ignore rules: %v", err)
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			logrus.Errorf("Error accessing path %s: %v", path, err)
+			return fmt.Errorf("error accessing path %s: %w", path, err)
+		}
+
+		if !d.IsDir() {
+			files = append(files, path)
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return fmt.Errorf("failed to compute relative path of %s: %w", path, err)
+		}
+		relativePath = filepath.ToSlash(relativePath)
+
+		if relativePath == "." {
+			relativePath = ""
+		} else if d.Name() == ".git" || MatchAny(opts.Prune, d.Name()) || MatchAny(opts.Prune, relativePath) || matcher.Ignored(relativePath, true) {
+			logrus.Debugf("Pruning directory: %s", path)
+			return filepath.SkipDir
+		}
+
+		if opts.Gitignore {
+			if err := matcher.AddFile(filepath.Join(path, ".gitignore"), relativePath); err != nil {
+				logrus.Warnf("Failed to load ignore rules: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("Failed to read directory recursively: %v", err)
+		return nil, fmt.Errorf("failed to read directory recursively: %w", err)
 	}
+	logrus.Debugf("Total files found in %s after pruning: %d", dirPath, len(files))
+	return files, nil
+}
+
+// ReadDirPrunedFunc defaults to ReadDirPruned but can be overridden in tests.
+var ReadDirPrunedFunc = ReadDirPruned
 
-	cmd := exec.Command("open", dirPath)
+// openerCommands returns the commands tried in order to open a directory on goos.
+func openerCommands(goos string) [][]string {
+	switch goos {
+	case "darwin":
+		return [][]string{{"open"}}
+	case "windows":
+		return [][]string{{"explorer"}}
+	default:
+		return [][]string{{"xdg-open"}, {"gio", "open"}}
+	}
+}
+
+// OpenDirectory opens dirPath in the file manager. opener is a command, with optional arguments, that the
+// path is appended to; when empty, the first available command of the platform is used: open on macOS,
+// explorer on Windows and xdg-open or gio open elsewhere.
+func OpenDirectory(dirPath, opener string) error {
+	logrus.Debugf("Attempting to open directory: %s", dirPath)
+
+	var command []string
+	if fields := strings.Fields(opener); len(fields) > 0 {
+		logrus.Debugf("Using configured opener: %s", opener)
+		command = fields
+	} else {
+		var tried []string
+		for _, candidate := range openerCommands(runtime.GOOS) {
+			if _, err := exec.LookPath(candidate[0]); err == nil {
+				command = candidate
+				break
+			}
+			tried = append(tried, strings.Join(candidate, " "))
+		}
+		if command == nil {
+			return fmt.Errorf("no command found to open directories (tried %s), set `opener` in the config", strings.Join(tried, ", "))
+		}
+	}
+
+	logrus.Debugf("Executing command: %s %s", strings.Join(command, " "), dirPath)
+	cmd := exec.Command(command[0], append(command[1:], dirPath)...)
 	err := cmd.Run()
+	// explorer exits with status 1 even when it opened the directory.
+	var exitErr *exec.ExitError
+	if err != nil && filepath.Base(command[0]) == "explorer" && errors.As(err, &exitErr) {
+		err = nil
+	}
 	if err != nil {
-		logrus.Errorf("Failed to open directory %s in Finder: %v", dirPath, err)
-		return fmt.Errorf("failed to open directory %s in Finder: %w", dirPath, err)
+		return fmt.Errorf("failed to open directory %s with %s: %w", dirPath, command[0], err)
 	}
-	logrus.Debugf("Directory opened in Finder successfully: %s", dirPath)
+	logrus.Debugf("Directory opened successfully: %s", dirPath)
 	return nil
 }
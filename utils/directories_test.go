@@ -139,47 +139,111 @@ func TestReadDirRecursive(t *testing.T) {
 	assert.Error(t, err)
 }
 
-// TestOpenInFinder tests the OpenInFinder function.
-func TestOpenInFinder(t *testing.T) {
-	tempDir := t.TempDir()
+func TestOpenerCommands(t *testing.T) {
+	assert.Equal(t, [][]string{{"open"}}, openerCommands("darwin"))
+	assert.Equal(t, [][]string{{"explorer"}}, openerCommands("windows"))
+	assert.Equal(t, [][]string{{"xdg-open"}, {"gio", "open"}}, openerCommands("linux"))
+	assert.Equal(t, [][]string{{"xdg-open"}, {"gio", "open"}}, openerCommands("freebsd"))
+}
 
-	// For non-darwin systems, the function should immediately return an error.
-	if runtime.GOOS != "darwin" {
-		err := OpenInFinder(tempDir)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "this function is only supported on macOS")
-		return
+// TestOpenDirectory tests OpenDirectory with fake openers on PATH.
+func TestOpenDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake openers are shell scripts")
 	}
+	tempDir := t.TempDir()
 
-	// On macOS, simulate the open command by overriding the PATH so that a fake "open" is used.
-	// Save the original PATH and restore it at the end.
+	// Replace PATH so that only the fake commands can be found.
 	origPath := os.Getenv("PATH")
 	defer os.Setenv("PATH", origPath)
-
-	// Create a temporary directory to hold our fake "open" command.
 	fakeDir := t.TempDir()
+	assert.NoError(t, os.Setenv("PATH", fakeDir))
 
-	// Helper to create a fake "open" command.
-	createFakeOpen := func(exitCode int) error {
-		fakeOpenPath := filepath.Join(fakeDir, "open")
-		script := fmt.Sprintf("#!/bin/sh\nexit %d\n", exitCode)
-		return os.WriteFile(fakeOpenPath, []byte(script), 0755)
-	}
+	err := OpenDirectory(tempDir, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no command found to open directories")
 
-	// Prepend the fakeDir to PATH.
-	newPath := fakeDir + string(os.PathListSeparator) + origPath
-	assert.NoError(t, os.Setenv("PATH", newPath))
+	// The fake opener records its arguments.
+	argsFile := filepath.Join(t.TempDir(), "args")
+	createFakeOpener := func(name string, exitCode int) {
+		script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\nexit %d\n", argsFile, exitCode)
+		assert.NoError(t, os.WriteFile(filepath.Join(fakeDir, name), []byte(script), 0755))
+	}
+	name := openerCommands(runtime.GOOS)[0][0]
 
-	// Test success: fake "open" returns 0.
-	err := createFakeOpen(0)
+	createFakeOpener(name, 0)
+	assert.NoError(t, OpenDirectory(tempDir, ""))
+	args, err := os.ReadFile(argsFile)
 	assert.NoError(t, err)
-	err = OpenInFinder(tempDir)
+	assert.Equal(t, tempDir+"\n", string(args))
+
+	createFakeOpener(name, 1)
+	err = OpenDirectory(tempDir, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open directory")
+
+	if runtime.GOOS == "linux" {
+		// gio is used when xdg-open is missing.
+		assert.NoError(t, os.Remove(filepath.Join(fakeDir, "xdg-open")))
+		createFakeOpener("gio", 0)
+		assert.NoError(t, OpenDirectory(tempDir, ""))
+		args, err = os.ReadFile(argsFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "open "+tempDir+"\n", string(args))
+	}
+
+	// A configured opener wins and keeps its arguments.
+	createFakeOpener("my-opener", 0)
+	assert.NoError(t, OpenDirectory(tempDir, "my-opener --new-window"))
+	args, err = os.ReadFile(argsFile)
 	assert.NoError(t, err)
+	assert.Equal(t, "--new-window "+tempDir+"\n", string(args))
+}
+
+func TestReadDirPruned(t *testing.T) {
+	baseDir := t.TempDir()
+	write := func(rel, content string) string {
+		path := filepath.Join(baseDir, filepath.FromSlash(rel))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
 
-	// Test failure: fake "open" returns non-zero.
-	err = createFakeOpen(1)
+	rootEnv := write(".env", "A=1")
+	webEnv := write("apps/web/.env", "A=1")
+	apiEnv := write("apps/api/.env", "A=1")
+	write(".gitignore", ".env\nbuild/\n")
+	write(".git/info/exclude", "scratch\n")
+	write(".git/config", "")
+	write("node_modules/pkg/.env", "A=1")
+	write("apps/web/node_modules/pkg/.env", "A=1")
+	write("build/.env", "A=1")
+	write("scratch/.env", "A=1")
+	write("target/.env", "A=1")
+	write("apps/web/.gitignore", "/generated\n")
+	write("apps/web/generated/.env", "A=1")
+	write("apps/api/generated/.env", "A=1")
+
+	files, err := ReadDirPruned(baseDir, PruneOptions{Prune: []string{"node_modules", "target"}, Gitignore: true})
+	assert.NoError(t, err)
+
+	expected := []string{
+		rootEnv,
+		filepath.Join(baseDir, ".gitignore"),
+		webEnv,
+		filepath.Join(baseDir, "apps", "web", ".gitignore"),
+		apiEnv,
+		filepath.Join(baseDir, "apps", "api", "generated", ".env"),
+	}
+	sort.Strings(files)
+	sort.Strings(expected)
+	assert.Equal(t, expected, files, "Expected ignored files to be listed and ignored directories to be pruned")
+
+	files, err = ReadDirPruned(baseDir, PruneOptions{})
 	assert.NoError(t, err)
-	err = OpenInFinder(tempDir)
+	assert.Contains(t, files, filepath.Join(baseDir, "build", ".env"))
+	assert.NotContains(t, files, filepath.Join(baseDir, ".git", "config"), "Expected .git to always be pruned")
+
+	_, err = ReadDirPruned(filepath.Join(baseDir, "nonexistent"), PruneOptions{})
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to open directory")
 }
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -32,6 +35,7 @@ func CheckFileExists(dir string, fileName string) (bool, error) {
 	return true, nil
 }
 
+// CopyFile copies source to destination atomically, keeping the mode of source.
 func CopyFile(source, destination string) error {
 	logrus.Debugf("Copying file from source: %s to destination: %s", source, destination)
 	if source == "" || destination == "" {
@@ -50,39 +54,152 @@ func CopyFile(source, destination string) error {
 		}
 	}()
 
-	destFile, err := os.Create(destination)
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		logrus.Errorf("Failed to stat source file %s: %v", source, err)
+		return fmt.Errorf("failed to stat source file %s: %w", source, err)
+	}
+
+	// The destination keeps the mode of the source rather than 0666 minus umask.
+	err = writeAtomic(destination, srcInfo.Mode().Perm(), func(w io.Writer) error {
+		copiedBytes, err := io.Copy(w, srcFile)
+		if err != nil {
+			return fmt.Errorf("failed to copy file %s to %s: %w", source, destination, err)
+		}
+		logrus.Debugf("Copied %d bytes from %s to %s", copiedBytes, source, destination)
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("Failed to copy file from %s to %s: %v", source, destination, err)
+		return err
+	}
+	logrus.Debugf("File copy completed successfully from %s to %s", source, destination)
+	return nil
+}
+
+// WriteFileAtomic writes data to path through a temporary file in the same directory that is synced and
+// renamed over path, so that an interrupted write never leaves a partially written file behind.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeAtomic(path, perm, func(w io.Writer) error {
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+func writeAtomic(destination string, perm os.FileMode, write func(w io.Writer) error) error {
+	// Write through symlinks instead of replacing them with a regular file.
+	if resolved, err := filepath.EvalSymlinks(destination); err == nil {
+		destination = resolved
+	}
+	if info, err := os.Stat(destination); err == nil && info.IsDir() {
+		return fmt.Errorf("failed to create destination file %s: is a directory", destination)
+	}
+
+	dir := filepath.Dir(destination)
+	tempFile, err := os.CreateTemp(dir, "."+filepath.Base(destination)+".tmp-*")
 	if err != nil {
-		logrus.Errorf("Failed to create destination file %s: %v", destination, err)
 		return fmt.Errorf("failed to create destination file %s: %w", destination, err)
 	}
+	tempPath := tempFile.Name()
+	committed := false
 	defer func() {
-		if cerr := destFile.Close(); cerr != nil {
-			logrus.Errorf("Error closing destination file %s: %v", destination, cerr)
+		if !committed {
+			tempFile.Close()
+			os.Remove(tempPath)
 		}
 	}()
 
-	copiedBytes, err := io.Copy(destFile, srcFile)
-	if err != nil {
-		logrus.Errorf("Failed to copy file from %s to %s: %v", source, destination, err)
-		return fmt.Errorf("failed to copy file %s to %s: %w", source, destination, err)
+	if err := write(tempFile); err != nil {
+		return err
 	}
-	logrus.Debugf("Copied %d bytes from %s to %s", copiedBytes, source, destination)
+	// CreateTemp uses 0600, the mode is applied before the file becomes visible at the destination.
+	if err := tempFile.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set mode of destination file %s: %w", destination, err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync destination file %s: %w", destination, err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close destination file %s: %w", destination, err)
+	}
+	if err := os.Rename(tempPath, destination); err != nil {
+		return fmt.Errorf("failed to replace destination file %s: %w", destination, err)
+	}
+	committed = true
 
-	// NOTE: The second io.Copy is redundant as the source is likely at EOF.
-	// However, it is retained to follow the original logic.
-	if _, err := io.Copy(destFile, srcFile); err != nil {
-		logrus.Errorf("Failed to copy contents from %s to %s: %v", source, destination, err)
-		return fmt.Errorf("failed to copy contents from %s to %s: %w", source, destination, err)
+	// Persist the rename itself; not every platform supports syncing a directory.
+	if dirFile, err := os.Open(dir); err == nil {
+		_ = dirFile.Sync()
+		dirFile.Close()
 	}
-	logrus.Debugf("File copy completed successfully from %s to %s", source, destination)
 	return nil
 }
 
 // CopyFileFunc is a variable that can be overridden in tests.
 var CopyFileFunc = CopyFile
 
+// BackupTimestampLayout is the time layout used in backup folder names.
+const BackupTimestampLayout = "2006-01-02_15-04-05"
+
 func GetBackupTimestamp() string {
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
+	timestamp := time.Now().Format(BackupTimestampLayout)
 	logrus.Debugf("Generated backup timestamp: %s", timestamp)
 	return timestamp
 }
+
+// ParseBackupTimestamp parses a timestamp created by GetBackupTimestamp in the local time zone.
+func ParseBackupTimestamp(timestamp string) (time.Time, error) {
+	parsed, err := time.ParseInLocation(BackupTimestampLayout, timestamp, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid backup timestamp %q: %w", timestamp, err)
+	}
+	return parsed, nil
+}
+
+// HashFile returns the hex encoded SHA-256 digest of the file contents.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash file %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// HashBytes returns the hex encoded SHA-256 digest of data, matching HashFile for a file with the same contents.
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// FilesIdentical reports whether both files have exactly the same contents.
+func FilesIdentical(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat file %s: %w", a, err)
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat file %s: %w", b, err)
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+
+	dataA, err := os.ReadFile(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file %s: %w", a, err)
+	}
+	dataB, err := os.ReadFile(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file %s: %w", b, err)
+	}
+	return bytes.Equal(dataA, dataB), nil
+}
@@ -135,6 +135,89 @@ func TestCopyFileSuccess(t *testing.T) {
 	assert.Equal(t, originalContent, string(destContent))
 }
 
+func TestWriteFileAtomic(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, ".env")
+	assert.NoError(t, os.WriteFile(path, []byte("OLD=1\n"), 0644))
+
+	assert.NoError(t, WriteFileAtomic(path, []byte("NEW=1\n"), 0600))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "NEW=1\n", string(data))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := os.ReadDir(tempDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "Expected no temporary file to be left behind")
+
+	// Symlinks are written through rather than replaced.
+	link := filepath.Join(tempDir, "link.env")
+	assert.NoError(t, os.Symlink(path, link))
+	assert.NoError(t, WriteFileAtomic(link, []byte("LINKED=1\n"), 0600))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "LINKED=1\n", string(data))
+	info, err = os.Lstat(link)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+
+	err = WriteFileAtomic(tempDir, []byte("x"), 0600)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is a directory")
+	err = WriteFileAtomic(filepath.Join(tempDir, "missing", ".env"), []byte("x"), 0600)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create destination file")
+}
+
+func TestCopyFilePreservesMode(t *testing.T) {
+	tempDir := t.TempDir()
+	source := filepath.Join(tempDir, "source.env")
+	assert.NoError(t, os.WriteFile(source, []byte("KEY=value\n"), 0640))
+	assert.NoError(t, os.Chmod(source, 0640))
+
+	// An existing destination gets the mode of the source as well.
+	dest := filepath.Join(tempDir, "dest.env")
+	assert.NoError(t, os.WriteFile(dest, []byte("OLD=1\n"), 0666))
+	assert.NoError(t, os.Chmod(dest, 0666))
+
+	assert.NoError(t, CopyFile(source, dest))
+	info, err := os.Stat(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+// --- Tests for FilesIdentical ---
+
+func TestFilesIdentical(t *testing.T) {
+	tempDir := t.TempDir()
+	a := filepath.Join(tempDir, "a.env")
+	b := filepath.Join(tempDir, "b.env")
+	c := filepath.Join(tempDir, "c.env")
+	d := filepath.Join(tempDir, "d.env")
+	assert.NoError(t, os.WriteFile(a, []byte("KEY=value"), 0644))
+	assert.NoError(t, os.WriteFile(b, []byte("KEY=value"), 0644))
+	assert.NoError(t, os.WriteFile(c, []byte("KEY=other"), 0644))
+	assert.NoError(t, os.WriteFile(d, []byte("KEY=longer value"), 0644))
+
+	identical, err := FilesIdentical(a, b)
+	assert.NoError(t, err)
+	assert.True(t, identical)
+
+	identical, err = FilesIdentical(a, c)
+	assert.NoError(t, err)
+	assert.False(t, identical, "Expected same-size files with different content to differ")
+
+	identical, err = FilesIdentical(a, d)
+	assert.NoError(t, err)
+	assert.False(t, identical)
+
+	_, err = FilesIdentical(a, filepath.Join(tempDir, "missing.env"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to stat file")
+}
+
 // --- Test for GetBackupTimestamp ---
 
 func TestGetBackupTimestamp(t *testing.T) {
@@ -152,3 +235,30 @@ func TestGetBackupTimestamp(t *testing.T) {
 	// Allow a margin of 2 seconds.
 	assert.LessOrEqual(t, diff.Seconds(), 2.0, fmt.Sprintf("Timestamp difference too high: %v", diff))
 }
+
+func TestParseBackupTimestamp(t *testing.T) {
+	parsed, err := ParseBackupTimestamp("2024-05-01_10-30-15")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 30, 15, 0, time.Local), parsed)
+
+	_, err = ParseBackupTimestamp(GetBackupTimestamp())
+	assert.NoError(t, err)
+
+	_, err = ParseBackupTimestamp("2024-05-01")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid backup timestamp")
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	assert.NoError(t, os.WriteFile(path, []byte("hello"), 0644))
+
+	hash, err := HashFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", hash)
+
+	_, err = HashFile(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open file")
+	assert.Equal(t, hash, HashBytes([]byte("hello")))
+}
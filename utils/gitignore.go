@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/sirupsen/logrus"
+)
+
+type ignoreRule struct {
+	// base is the slash-separated directory of the ignore file relative to the walk root, "" for the root itself.
+	base    string
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreMatcher evaluates gitignore rules collected from one or more ignore files.
+// Rules added later take precedence, so files must be added from the root downwards.
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+// AddFile reads the ignore file at path and scopes its rules to base. A missing file is not an error.
+func (m *IgnoreMatcher) AddFile(path, base string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open ignore file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		m.AddPattern(scanner.Text(), base)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read ignore file %s: %w", path, err)
+	}
+	logrus.Debugf("Loaded ignore file: %s", path)
+	return nil
+}
+
+// AddPattern adds a single gitignore line scoped to base. Blank lines, comments and invalid patterns are skipped.
+func (m *IgnoreMatcher) AddPattern(line, base string) {
+	pattern := strings.TrimRight(line, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	// A pattern containing a slash is relative to the ignore file, anything else matches at any depth.
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		pattern = "**/" + pattern
+	}
+	if pattern == "" || !doublestar.ValidatePattern(pattern) {
+		logrus.Debugf("Skipping invalid ignore pattern: %q", line)
+		return
+	}
+
+	rule.pattern = pattern
+	m.rules = append(m.rules, rule)
+}
+
+// Ignored reports whether the slash-separated path, relative to the walk root, is ignored.
+func (m *IgnoreMatcher) Ignored(relativePath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		path := relativePath
+		if rule.base != "" {
+			if !strings.HasPrefix(relativePath, rule.base+"/") {
+				continue
+			}
+			path = strings.TrimPrefix(relativePath, rule.base+"/")
+		}
+
+		if doublestar.MatchUnvalidated(rule.pattern, path) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m := &IgnoreMatcher{}
+	for _, line := range []string{
+		"# comment",
+		"",
+		"build/",
+		"/dist",
+		"*.log",
+		"docs/generated",
+		"**/cache",
+		"!keep.log",
+		`\#hash`,
+	} {
+		m.AddPattern(line, "")
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"build", true, true},
+		{"apps/web/build", true, true},
+		{"build", false, false},
+		{"dist", true, true},
+		{"apps/dist", true, false},
+		{"debug.log", false, true},
+		{"apps/keep.log", false, false},
+		{"docs/generated", true, true},
+		{"apps/docs/generated", true, false},
+		{"a/b/cache", true, true},
+		{"#hash", false, true},
+		{"src", true, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, m.Ignored(tt.path, tt.isDir), tt.path)
+	}
+}
+
+func TestIgnoreMatcher_NestedBase(t *testing.T) {
+	m := &IgnoreMatcher{}
+	m.AddPattern("out", "")
+	m.AddPattern("/generated", "apps/web")
+	m.AddPattern("!out", "apps/api")
+
+	assert.True(t, m.Ignored("apps/web/generated", true))
+	assert.False(t, m.Ignored("generated", true))
+	assert.False(t, m.Ignored("apps/api/generated", true))
+	assert.True(t, m.Ignored("apps/web/out", true))
+	assert.False(t, m.Ignored("apps/api/out", true), "Expected the deeper negation to win")
+}
+
+func TestIgnoreMatcher_AddFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".gitignore")
+	assert.NoError(t, os.WriteFile(path, []byte("tmp/\r\n*.bak\n"), 0644))
+
+	m := &IgnoreMatcher{}
+	assert.NoError(t, m.AddFile(path, ""))
+	assert.True(t, m.Ignored("tmp", true))
+	assert.True(t, m.Ignored("x/y.bak", false))
+
+	assert.NoError(t, m.AddFile(filepath.Join(dir, "missing"), ""), "Expected a missing ignore file to be skipped")
+}
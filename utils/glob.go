@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// ValidatePatterns checks that every pattern is a valid doublestar glob.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("invalid glob pattern: %q", pattern)
+		}
+	}
+	return nil
+}
+
+// MatchAny reports whether relativePath matches at least one of the patterns.
+// Patterns use forward slashes and support `**` for any number of directories.
+func MatchAny(patterns []string, relativePath string) bool {
+	path := filepath.ToSlash(relativePath)
+	for _, pattern := range patterns {
+		if doublestar.MatchUnvalidated(pattern, path) {
+			logrus.Debugf("Path %s matched pattern %s", path, pattern)
+			return true
+		}
+	}
+	return false
+}
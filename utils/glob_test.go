@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePatterns(t *testing.T) {
+	assert.NoError(t, ValidatePatterns([]string{"**/*.env", "**/.env.*", "secrets.env.json"}))
+	assert.NoError(t, ValidatePatterns(nil))
+
+	err := ValidatePatterns([]string{"**/*.env", "[unclosed"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid glob pattern")
+}
+
+func TestMatchAny(t *testing.T) {
+	patterns := []string{"**/*.env", "**/.env.*", "**/.envrc"}
+
+	for path, want := range map[string]bool{
+		".env":                                true,
+		"apps/web/.env":                       true,
+		filepath.Join("apps", "api", ".env"):  true,
+		".env.local":                          true,
+		"apps/web/.env.development":           true,
+		".envrc":                              true,
+		"secrets.env.json":                    false,
+		"README.md":                           false,
+		filepath.Join("apps", "web", "a.txt"): false,
+	} {
+		assert.Equal(t, want, MatchAny(patterns, path), path)
+	}
+
+	assert.False(t, MatchAny(nil, ".env"))
+}
@@ -40,3 +40,11 @@ func CyanText(text string) string {
 func GreenText(text string) string {
 	return color.New(color.FgGreen).Sprint(text)
 }
+
+func RedText(text string) string {
+	return color.New(color.FgRed).Sprint(text)
+}
+
+func YellowText(text string) string {
+	return color.New(color.FgYellow).Sprint(text)
+}
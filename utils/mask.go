@@ -0,0 +1,11 @@
+package utils
+
+const maskedValue = "****"
+
+// MaskValue hides a secret value while still telling empty values apart.
+func MaskValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	return maskedValue
+}
@@ -0,0 +1,13 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskValue(t *testing.T) {
+	assert.Equal(t, "", MaskValue(""))
+	assert.Equal(t, "****", MaskValue("s3cr3t"))
+	assert.Equal(t, "****", MaskValue("a much longer secret value"))
+}